@@ -122,3 +122,57 @@ func TestEmptyTagsAndLongName(t *testing.T) {
 	assert.Equal(t, "*structor_test.T.S.B[1].d", v.S.B[1].d)
 	assert.Equal(t, "*structor_test.T.e[42].f", v.e[42].f)
 }
+
+func TestCycles(t *testing.T) {
+	type Node struct {
+		Name   string `eval:"{{.Val}}!"`
+		Parent *Node
+		Prev   *Node
+		Next   *Node
+		Shared *[]*Node
+		Any    interface{}
+	}
+	root := &Node{Name: "root"}
+	a := &Node{Name: "a", Parent: root}
+	b := &Node{Name: "b", Parent: root, Prev: a}
+	a.Next = b
+	shared := []*Node{root, a, b}
+	root.Shared = &shared
+	a.Shared = &shared
+	b.Shared = &shared
+	m := map[string]interface{}{"root": root}
+	m["self"] = m
+	root.Any = m
+	ev := structor.NewDefaultEvaluator(nil)
+	err := ev.Eval(root, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "root!", root.Name)
+	assert.Equal(t, "a!", a.Name)
+	assert.Equal(t, "b!", b.Name)
+}
+
+func TestMaxDepth(t *testing.T) {
+	type L3 struct {
+		A string `eval:"aaa"`
+	}
+	type L2 struct{ L3 L3 }
+	type L1 struct{ L2 *L2 }
+	ev := structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{"eval": &el.DefaultInterpreter{}},
+		structor.Options{MaxDepth: 3})
+	v := &L1{L2: &L2{}}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa", v.L2.L3.A)
+
+	ev = structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{"eval": &el.DefaultInterpreter{}},
+		structor.Options{MaxDepth: 2})
+	v = &L1{L2: &L2{}}
+	err = ev.Eval(v, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "<<*structor_test.L1.L2.L3.A>> max depth (2) exceeded")
+	assert.Equal(t, "", v.L2.L3.A)
+}
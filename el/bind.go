@@ -0,0 +1,65 @@
+package el
+
+import "reflect"
+
+var contextType = reflect.TypeOf((*Context)(nil))
+
+// BindContext returns function f with its first argument bound to ctx, if f
+// is a function, which first argument is of type *Context. Otherwise it
+// returns f as is.
+//
+// Interpreters use it to pass context implicitly to the custom functions,
+// which need it (to cache values within evaluation, for example). Such
+// functions are invoked in expressions without first argument.
+func BindContext(f interface{}, ctx *Context) interface{} {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func {
+		return f
+	}
+	t := v.Type()
+	if t.NumIn() == 0 || t.In(0) != contextType {
+		return f
+	}
+	in := make([]reflect.Type, 0, t.NumIn()-1)
+	for i, l := 1, t.NumIn(); i < l; i++ {
+		in = append(in, t.In(i))
+	}
+	out := make([]reflect.Type, 0, t.NumOut())
+	for i, l := 0, t.NumOut(); i < l; i++ {
+		out = append(out, t.Out(i))
+	}
+	ctxV := reflect.ValueOf(ctx)
+	bound := reflect.MakeFunc(
+		reflect.FuncOf(in, out, t.IsVariadic()),
+		func(args []reflect.Value) []reflect.Value {
+			args = append([]reflect.Value{ctxV}, args...)
+			if t.IsVariadic() {
+				return v.CallSlice(args)
+			}
+			return v.Call(args)
+		})
+	return bound.Interface()
+}
+
+// Cached returns value, cached within the current evaluation by the key, or
+// evaluates it with f and stores it into the cache. Key should be comparable.
+// Errors are not cached. If context has no cache, f is simply invoked.
+//
+// It's intended to be used by custom functions to avoid repeated expensive
+// computations (parsing of the same document, for example).
+func (ctx *Context) Cached(
+	key interface{},
+	f func() (interface{}, error)) (interface{}, error) {
+	if ctx == nil || ctx.Cache == nil {
+		return f()
+	}
+	if v, ok := ctx.Cache[key]; ok {
+		return v, nil
+	}
+	v, err := f()
+	if err != nil {
+		return nil, err
+	}
+	ctx.Cache[key] = v
+	return v, nil
+}
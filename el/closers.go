@@ -0,0 +1,46 @@
+package el
+
+import (
+	"io"
+	"sync"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// Closers collects resources, opened by custom functions during evaluation,
+// to be closed by calling code when evaluation is finished.
+type Closers struct {
+	mu      sync.Mutex
+	closers []io.Closer
+}
+
+// Add registers resource to be closed.
+func (c *Closers) Add(closer io.Closer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closers = append(c.closers, closer)
+}
+
+// Close closes all registered resources in reverse order and forgets them.
+// It returns all errors, returned by resources.
+func (c *Closers) Close() error {
+	c.mu.Lock()
+	closers := c.closers
+	c.closers = nil
+	c.mu.Unlock()
+	var merr *multierror.Error
+	for i := len(closers) - 1; i >= 0; i-- {
+		merr = multierror.Append(merr, closers[i].Close())
+	}
+	return merr.ErrorOrNil()
+}
+
+// Track registers resource within the context to be closed when evaluation
+// is finished and returns it. If context has no Closers, resource is
+// returned as is, and it's a responsibility of the caller to close it.
+func (ctx *Context) Track(closer io.Closer) io.Closer {
+	if ctx != nil && ctx.Closers != nil {
+		ctx.Closers.Add(closer)
+	}
+	return closer
+}
@@ -2,20 +2,29 @@
 Package el provides an interface and default implementation of expression
 language (EL) interpreter for struct tags.
 
-Default implementation is simply based on "text/template".
+Default implementation is simply based on "text/template". HTMLInterpreter is
+its variant, based on "html/template".
 */
 package el
 
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 // Interpreter is an interface of EL interpreter.
+//
+// Custom functions, which accept *Context as the first argument (like
+// functions of "funcs/goquery", "funcs/xpath" and "funcs/json" packages),
+// expect interpreter to pass current context to them implicitly.
+// Implementations should wrap such functions with BindContext() before making
+// them available to expressions (interpreters of this repository do it).
 type Interpreter interface {
 	// Execute parses and executes expression with a given context.
 	Execute(expression string, ctx *Context) (result interface{}, err error)
@@ -40,23 +49,58 @@ type Context struct {
 	LongName string
 	// Current value of the currently processed filed.
 	Val interface{}
+	// Static type of the currently processed field, result of expression is
+	// converted to (nil for struct-level expressions). Unlike type of Val, it
+	// is known for nil pointers and interfaces.
+	Type reflect.Type
 	// All other tags of the currently processed field.
 	Tags map[string]string
+	// Name of the tag, which contains currently processed expression.
+	TagName string
+	// Part of the TagName, matched by the pattern, which interpreter was
+	// registered with (for example, "json" for tag "eval.json" and pattern
+	// "eval.*"). Empty if interpreter was registered with exact tag name.
+	TagSuffix string
 	// Currently processed struct.
 	Struct interface{}
+	// Currently processed (sub)struct, which owns currently processed field.
+	// Pointer to the struct, if it is addressable.
+	Owner interface{}
 	// Extra context structure.
 	Extra interface{}
 	// Temporary partial result evaluated on the current substruct.
 	Sub interface{}
+	// Additional custom functions, passed by calling code for the current
+	// evaluation. Take precedence over interpreter's own functions.
+	Funcs use.FuncMap
+	// Variables, shared by expressions within the current evaluation.
+	// Calling code creates nested scope for every nested struct.
+	Vars *Vars
+	// Cache of values, shared by custom functions within the current
+	// evaluation. See Cached().
+	Cache map[interface{}]interface{}
+	// Resources, opened by custom functions within the current evaluation.
+	// Calling code closes them when evaluation is finished. See Track().
+	Closers *Closers
 	// Function, which knows how to evaluate expression with different
 	// interpreter.
 	EvalExpr EvalExprFunc
+	// Function, which checks if custom function with given name is allowed
+	// within the current context (nil allows all functions). Calling code
+	// sets it to restrict untrusted expressions. See Restrict().
+	CheckFunc func(name string) error
+	// Depth of nested expressions, which led to the current expression
+	// (zero for expression of the field's tag). EvalExpr evaluates nested
+	// expression with a copy of context with incremented EvalDepth. See
+	// Tracker.CheckDepth().
+	EvalDepth int
 }
 
 // EvalExprFunc is a type of function, which knows how to evaluate given
 // expression using given interpreter name and context.
 // It is used to implement special predefined custom function "eval", available
-// within EL.
+// within EL. Implementation should pass a copy of context with incremented
+// EvalDepth to the interpreter.
 type EvalExprFunc func(
 	interpreterName, expression string,
 	context *Context) (interface{}, error)
@@ -64,11 +108,16 @@ type EvalExprFunc func(
 // DefaultInterpreter is a default implementation of Interpreter,
 // which is based on "text/template".
 //
-// Besides Funcs passed to it, DefaultInterpreter creates these additional
+// Besides Funcs passed to it (and Context.Funcs, passed with the current
+// evaluation), DefaultInterpreter creates these additional
 // custom function for use in EL expressions:
 //
 //  - set
 //  - eval
+//  - field
+//  - setField
+//  - let
+//  - var
 //
 // Function "set" with signature `func (r interface{}) interface{}` passes
 // argument to result, but stores it internally to be used as an expression
@@ -87,6 +136,40 @@ type EvalExprFunc func(
 // implementation (structor.NewEvaluator()) interpreter name is a tag name,
 // onto which given interpreter is mapped during creation of evaluator.
 //
+// Function "field" with signature `func(tag, name string) (interface{}, error)`
+// returns value of the sibling field (field of Context.Owner) by its name,
+// defined by the conventional tag (like "json" or "yaml"). Empty tag means Go
+// field name. See FieldByName().
+//
+// Function "setField" with signature
+// `func(name string, value interface{}) (string, error)` assigns value to
+// the sibling field with given Go name (see SetField()). It returns empty
+// string to not affect template's output. It allows to compute several
+// fields with one (expensive) expression.
+//
+// Function "let" with signature
+// `func(name string, value interface{}) (string, error)` stores value into
+// variable within the current scope of Context.Vars (scope of the currently
+// processed struct). It returns empty string to not affect template's output.
+// Function "var" with signature
+// `func(name string) (interface{}, error)` returns value of the variable,
+// defined in the current or enclosing scope. They allow to compute value once
+// and reuse it in later expressions.
+//
+// Named templates, defined in Templates and TemplateFiles, are parsed once
+// and every expression is cloned from them, so they can be invoked from
+// expressions with `{{template "name" .}}`. Only Funcs and special functions
+// above can be used within named templates (Context.Funcs are not known at
+// the time of parsing).
+//
+// Custom functions, which first argument is of type *Context, are bound to
+// the current context (see BindContext()). Custom functions (and special
+// functions "setField" and "let"), not allowed by Context.CheckFunc, are
+// replaced with stubs returning error (see Restrict()).
+//
+// Resources, consumed by expression, can be restricted with Limits. If any
+// of limits is exceeded, Execute returns *LimitError.
+//
 // Restrictions of "text/template" package applied to custom functions.
 type DefaultInterpreter struct {
 	// Custom functions, available for use in EL expressions.
@@ -100,55 +183,161 @@ type DefaultInterpreter struct {
 	// simplified expressions. For example, `atoi "42"` instead of
 	// `{{atoi "42"}}`.
 	AutoEnclose bool
+	// Named templates (`{{define "name"}}...{{end}}`), shared by all
+	// expressions.
+	Templates []string
+	// Glob patterns of files with named templates, shared by all expressions.
+	// See "text/template".ParseGlob().
+	TemplateFiles []string
+	// Limits of resources, consumed by expression.
+	Limits Limits
+
+	baseOnce sync.Once
+	base     *template.Template
+	baseErr  error
 }
 
 // Execute implements Interpreter.Execute()
 func (i *DefaultInterpreter) Execute(
 	expression string,
 	ctx *Context) (interface{}, error) {
-	funcs := template.FuncMap{}
-	for k, v := range i.Funcs {
-		funcs[k] = v
-	}
 	var res interface{}
 	resultEvaluated := false
-	funcs["set"] = func(r interface{}) interface{} {
+	tracker := i.Limits.NewTracker(ctx)
+	if err := tracker.CheckDepth(); err != nil {
+		return nil, err
+	}
+	funcs := templateFuncs(i.Funcs, ctx, tracker, func(r interface{}) {
 		res = r
 		resultEvaluated = true
+	})
+	templName := fmt.Sprintf("<<%s>>", ctx.LongName)
+	if i.AutoEnclose {
+		expression = enclose(expression, i.LeftDelim, i.RightDelim)
+	}
+	t, err := i.newTemplate(templName)
+	if err != nil {
+		return nil, err
+	}
+	t, err = t.Funcs(template.FuncMap(funcs)).Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(tracker.Writer(&buf), ctx)
+	if err := tracker.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resultEvaluated {
+		return res, nil
+	}
+	return buf.String(), nil
+}
+
+// templateFuncs returns custom functions along with special functions, bound
+// to ctx and tracked by tracker. Function setResult is invoked by special
+// function "set".
+func templateFuncs(
+	custom use.FuncMap,
+	ctx *Context,
+	tracker *Tracker,
+	setResult func(interface{})) map[string]interface{} {
+	funcs := map[string]interface{}{}
+	for k, v := range custom {
+		funcs[k] = BindContext(ctx.Restrict(k, v), ctx)
+	}
+	if ctx != nil {
+		for k, v := range ctx.Funcs {
+			funcs[k] = BindContext(ctx.Restrict(k, v), ctx)
+		}
+	}
+	funcs["set"] = func(r interface{}) interface{} {
+		setResult(r)
 		return r
 	}
 	funcs["eval"] = func(intrpr, expr string) (interface{}, error) {
-		return ctx.EvalExpr(intrpr, expr, ctx)
+		return tracker.Eval(intrpr, expr)
 	}
-	templName := fmt.Sprintf("<<%s>>", ctx.LongName)
-	left := i.LeftDelim
-	right := i.RightDelim
+	funcs["field"] = func(tag, name string) (interface{}, error) {
+		return FieldByName(ctx.Owner, tag, name)
+	}
+	// Functions, which change state outside of the expression, can be
+	// restricted, like custom ones.
+	funcs["setField"] = ctx.Restrict("setField", func(name string, value interface{}) (string, error) {
+		return "", SetField(ctx.Owner, "", name, value)
+	})
+	funcs["let"] = ctx.Restrict("let", func(name string, value interface{}) (string, error) {
+		if ctx.Vars == nil {
+			return "", fmt.Errorf("let %s: no variables in context", name)
+		}
+		ctx.Vars.Let(name, value)
+		return "", nil
+	})
+	funcs["var"] = func(name string) (interface{}, error) {
+		return ctx.Vars.Get(name)
+	}
+	for k, f := range funcs {
+		funcs[k] = tracker.Func(f)
+	}
+	return funcs
+}
+
+// delims returns delimiters, replacing empty values with defaults.
+func delims(left, right string) (string, string) {
 	if left == "" {
 		left = "{{"
 	}
 	if right == "" {
 		right = "}}"
 	}
-	if i.AutoEnclose &&
-		!(strings.HasPrefix(expression, left) &&
-			strings.HasSuffix(expression, right)) {
-		expression = fmt.Sprintf("%s%s%s", left, expression, right)
+	return left, right
+}
+
+// enclose encloses expression into delimiters, if it is not already enclosed.
+func enclose(expression, left, right string) string {
+	left, right = delims(left, right)
+	if strings.HasPrefix(expression, left) &&
+		strings.HasSuffix(expression, right) {
+		return expression
 	}
-	t, err := template.
-		New(templName).
-		Delims(left, right).
-		Funcs(funcs).
-		Parse(expression)
-	if err != nil {
-		return nil, err
+	return fmt.Sprintf("%s%s%s", left, expression, right)
+}
+
+// newTemplate returns new empty template with given name, associated with
+// shared named templates, if there are any.
+func (i *DefaultInterpreter) newTemplate(name string) (*template.Template, error) {
+	left, right := delims(i.LeftDelim, i.RightDelim)
+	if len(i.Templates) == 0 && len(i.TemplateFiles) == 0 {
+		return template.New(name).Delims(left, right), nil
 	}
-	var buf bytes.Buffer
-	err = t.Execute(&buf, ctx)
+	i.baseOnce.Do(func() {
+		// Functions are only needed to parse templates here, actual
+		// implementations are bound to context before execution.
+		base := template.New("").Delims(left, right).
+			Funcs(template.FuncMap(templateFuncs(i.Funcs, nil, nil, nil)))
+		for n, s := range i.Templates {
+			if _, err := base.New(fmt.Sprintf("Templates[%d]", n)).Parse(s); err != nil {
+				i.baseErr = err
+				return
+			}
+		}
+		for _, g := range i.TemplateFiles {
+			if _, err := base.ParseGlob(g); err != nil {
+				i.baseErr = err
+				return
+			}
+		}
+		i.base = base
+	})
+	if i.baseErr != nil {
+		return nil, i.baseErr
+	}
+	t, err := i.base.Clone()
 	if err != nil {
 		return nil, err
 	}
-	if resultEvaluated {
-		return res, nil
-	}
-	return buf.String(), nil
+	return t.New(name), nil
 }
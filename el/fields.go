@@ -0,0 +1,104 @@
+package el
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/nikolay-turpitko/structor/scanner"
+)
+
+// FieldName returns name of the struct field, defined by the conventional
+// tag (like "json" or "yaml"): tag value till the first comma.  It returns Go
+// name of the field if tag is empty, absent, or its name part is empty or "-".
+// Tags are parsed by scanner.Default, so relaxed tag syntax is supported. Use
+// TagFieldName(), if tags are already parsed.
+func FieldName(f reflect.StructField, tag string) string {
+	if tag == "" {
+		return f.Name
+	}
+	tags, err := scanner.Default.Tags(f.Tag)
+	if err != nil {
+		return f.Name
+	}
+	return TagFieldName(f.Name, tags, tag)
+}
+
+// TagFieldName returns name of the field, defined by the conventional tag
+// within already parsed tags (see FieldName()), or name, if it's not defined.
+func TagFieldName(name string, tags map[string]string, tag string) string {
+	if tag == "" {
+		return name
+	}
+	v, ok := tags[tag]
+	if !ok {
+		return name
+	}
+	if i := strings.Index(v, ","); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" || v == "-" {
+		return name
+	}
+	return v
+}
+
+// FieldByName returns value of the field of struct s (or pointer to struct)
+// by its name, defined by the conventional tag (see FieldName()).
+func FieldByName(s interface{}, tag, name string) (interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(s))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("field %s: %T is not a struct", name, s)
+	}
+	f, ok := fieldByName(v, tag, name)
+	if !ok {
+		return nil, fmt.Errorf("field %s: not found in %T", name, s)
+	}
+	if !f.CanInterface() {
+		return nil, fmt.Errorf("field %s: unexported field", name)
+	}
+	return f.Interface(), nil
+}
+
+// SetField sets value of the field of struct, pointed by s, by its name,
+// defined by the conventional tag (see FieldName()). Value is converted to
+// the type of the field, nil value resets field to zero value.
+func SetField(s interface{}, tag, name string, value interface{}) error {
+	v := reflect.ValueOf(s)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("field %s: %T is not a pointer to struct", name, s)
+	}
+	f, ok := fieldByName(v.Elem(), tag, name)
+	if !ok {
+		return fmt.Errorf("field %s: not found in %T", name, s)
+	}
+	if !f.CanSet() {
+		return fmt.Errorf("field %s: unexported field", name)
+	}
+	return Assign(f, value)
+}
+
+// Assign sets value into settable v, converting it to the type of v.  Nil
+// value resets v to zero value.
+func Assign(v reflect.Value, value interface{}) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	vv := reflect.ValueOf(value)
+	if !vv.Type().ConvertibleTo(v.Type()) {
+		return fmt.Errorf("cannot convert %T to %s", value, v.Type())
+	}
+	v.Set(vv.Convert(v.Type()))
+	return nil
+}
+
+func fieldByName(v reflect.Value, tag, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i, l := 0, t.NumField(); i < l; i++ {
+		if FieldName(t.Field(i), tag) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -21,7 +21,8 @@ import (
 // Interpreter implements "github.com/nikolay-turpitko/structor/el".Interpreter
 // using "github.com/apaxa-go/eval". Thus, it evaluates Go-style expressions.
 //
-// Besides eval.Args passed to it, Interpreter creates these additional
+// Besides eval.Args passed to it (and el.Context.Funcs, passed with the
+// current evaluation), Interpreter creates these additional
 // custom objects for use in EL expressions:
 //
 //  - ctx
@@ -29,6 +30,10 @@ import (
 //  - ctxExtra
 //  - ctxSub
 //  - eval
+//  - field
+//  - setField
+//  - let
+//  - getVar
 //
 // Structure "ctx" is a context of type *el.Context.
 //
@@ -45,6 +50,25 @@ import (
 // implementation (structor.NewEvaluator()) interpreter name is a tag name,
 // onto which given interpreter is mapped during creation of evaluator.
 //
+// Function "field" with signature `func(tag, name string) interface{}`
+// returns value of the sibling field by its name, defined by the
+// conventional tag (like "json" or "yaml"). See el.FieldByName().
+//
+// Function "setField" with signature
+// `func(name string, value interface{}) interface{}` assigns value to the
+// sibling field with given Go name and returns value. See el.SetField().
+//
+// Functions "let" with signature `func(name string, value interface{})
+// interface{}` and "getVar" with signature `func(name string) interface{}`
+// store value into the variable within the current scope and return
+// variable's value (see el.Context.Vars). They are equivalents of "let" and
+// "var" of el.DefaultInterpreter ("var" is a keyword in Go).
+//
+// Custom functions, which first argument is of type *el.Context, are bound
+// to the current context (see el.BindContext()). Custom functions (and
+// special functions "setField" and "let"), not allowed by
+// el.Context.CheckFunc, are replaced with stubs (see el.Context.Restrict()).
+//
 // Due restrictions of "github.com/apaxa-go/eval", only custom functions
 // returning one or two results are  allowed. If custom function returns two
 // results, its second result must be of error type and it's converted to
@@ -53,6 +77,10 @@ import (
 type Interpreter struct {
 	// Arguments for expression.
 	Args eval.Args
+	// Limits of resources, consumed by expression (MaxOutput is not
+	// applicable). If any of limits is exceeded, Execute returns
+	// *el.LimitError.
+	Limits el.Limits
 }
 
 // Execute implements Interpreter.Execute()
@@ -63,15 +91,50 @@ func (i *Interpreter) Execute(
 	if err != nil {
 		return nil, fmt.Errorf("structor parse: <<%s>>: %v", ctx.LongName, err)
 	}
+	tracker := i.Limits.NewTracker(ctx)
+	if err := tracker.CheckDepth(); err != nil {
+		return nil, err
+	}
 	funcEval := func(intrpr, expr string) interface{} {
-		res, err := ctx.EvalExpr(intrpr, expr, ctx)
+		res, err := tracker.Eval(intrpr, expr)
+		if err != nil {
+			panic(err)
+		}
+		return res
+	}
+	funcField := func(tag, name string) interface{} {
+		res, err := el.FieldByName(ctx.Owner, tag, name)
+		if err != nil {
+			panic(err)
+		}
+		return res
+	}
+	funcSetField := func(name string, value interface{}) interface{} {
+		if err := el.SetField(ctx.Owner, "", name, value); err != nil {
+			panic(err)
+		}
+		return value
+	}
+	funcLet := func(name string, value interface{}) interface{} {
+		if ctx.Vars == nil {
+			panic(fmt.Errorf("let %s: no variables in context", name))
+		}
+		ctx.Vars.Let(name, value)
+		return value
+	}
+	funcGetVar := func(name string) interface{} {
+		res, err := ctx.Vars.Get(name)
 		if err != nil {
 			panic(err)
 		}
 		return res
 	}
 	args := eval.Args{
-		"eval":      eval.MakeDataRegularInterface(funcEval),
+		"eval":      eval.MakeDataRegularInterface(tracker.Func(funcEval)),
+		"field":     eval.MakeDataRegularInterface(tracker.Func(funcField)),
+		"setField":  eval.MakeDataRegularInterface(tracker.Func(ctx.Restrict("setField", funcSetField))),
+		"let":       eval.MakeDataRegularInterface(tracker.Func(ctx.Restrict("let", funcLet))),
+		"getVar":    eval.MakeDataRegularInterface(tracker.Func(funcGetVar)),
 		"ctx":       eval.MakeDataRegularInterface(ctx),
 		"ctxStruct": eval.MakeTypeInterface(ctx.Struct),
 	}
@@ -82,16 +145,64 @@ func (i *Interpreter) Execute(
 		args["ctxSub"] = eval.MakeTypeInterface(ctx.Sub)
 	}
 	for k, v := range i.Args {
-		args[k] = wrapFunc(v)
+		args[k] = track(wrapFunc(bindContext(restrict(k, v, ctx), ctx)), tracker)
+	}
+	for k, v := range eval.ArgsFromInterfaces(ctx.Funcs) {
+		args[k] = track(wrapFunc(bindContext(restrict(k, v, ctx), ctx)), tracker)
 	}
 	res, err := expr.EvalToInterface(args)
+	if err := tracker.Err(); err != nil {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("structor eval: <<%s>>: %v", ctx.LongName, err)
 	}
 	return res, nil
 }
 
-var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*el.Context)(nil))
+)
+
+// bindContext binds context to the function argument, if it needs it.
+// See el.BindContext().
+func bindContext(v eval.Value, ctx *el.Context) eval.Value {
+	if v.Kind() != eval.Datas || v.Data().Kind() != eval.Regular {
+		return v
+	}
+	r := v.Data().Regular()
+	if r.Kind() != reflect.Func ||
+		r.Type().NumIn() == 0 ||
+		r.Type().In(0) != contextType {
+		return v
+	}
+	return eval.MakeDataRegularInterface(el.BindContext(r.Interface(), ctx))
+}
+
+// restrict replaces function argument with a stub, if it is not allowed
+// within the context. See el.Context.Restrict().
+func restrict(name string, v eval.Value, ctx *el.Context) eval.Value {
+	if ctx.CheckFunc == nil ||
+		v.Kind() != eval.Datas ||
+		v.Data().Kind() != eval.Regular ||
+		v.Data().Regular().Kind() != reflect.Func {
+		return v
+	}
+	return eval.MakeDataRegularInterface(
+		ctx.Restrict(name, v.Data().Regular().Interface()))
+}
+
+// track wraps function argument to count its calls. See el.Tracker.Func().
+func track(v eval.Value, tracker *el.Tracker) eval.Value {
+	if v.Kind() != eval.Datas ||
+		v.Data().Kind() != eval.Regular ||
+		v.Data().Regular().Kind() != reflect.Func {
+		return v
+	}
+	return eval.MakeDataRegularInterface(
+		tracker.Func(v.Data().Regular().Interface()))
+}
 
 // wrapFunc check if argument is function with two return values, last of which
 // is error, and wraps such a function to return only one value, as apaxa-go
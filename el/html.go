@@ -0,0 +1,118 @@
+package el
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sync"
+
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// HTMLInterpreter is an implementation of Interpreter, which is based on
+// "html/template". It escapes evaluated output contextually and can be used
+// to compute fields, which are later rendered into HTML (message bodies,
+// for example).
+//
+// HTMLInterpreter supports the same special functions, delimiters,
+// automatic enclosing, named templates and limits as DefaultInterpreter.  Note, that
+// value stored with "set" function is returned as is, without escaping.
+//
+// Restrictions of "html/template" package applied to custom functions.
+type HTMLInterpreter struct {
+	// Custom functions, available for use in EL expressions.
+	Funcs use.FuncMap
+	// Left delimiter for templates.
+	LeftDelim string
+	// Right delimiter for templates.
+	RightDelim string
+	// Automatically enclose passed expression into delimiters before
+	// interpretation (if it is not already enclosed).
+	AutoEnclose bool
+	// Named templates (`{{define "name"}}...{{end}}`), shared by all
+	// expressions.
+	Templates []string
+	// Glob patterns of files with named templates, shared by all expressions.
+	// See "html/template".ParseGlob().
+	TemplateFiles []string
+	// Limits of resources, consumed by expression.
+	Limits Limits
+
+	baseOnce sync.Once
+	base     *template.Template
+	baseErr  error
+}
+
+// Execute implements Interpreter.Execute()
+func (i *HTMLInterpreter) Execute(
+	expression string,
+	ctx *Context) (interface{}, error) {
+	var res interface{}
+	resultEvaluated := false
+	tracker := i.Limits.NewTracker(ctx)
+	if err := tracker.CheckDepth(); err != nil {
+		return nil, err
+	}
+	funcs := templateFuncs(i.Funcs, ctx, tracker, func(r interface{}) {
+		res = r
+		resultEvaluated = true
+	})
+	templName := fmt.Sprintf("<<%s>>", ctx.LongName)
+	if i.AutoEnclose {
+		expression = enclose(expression, i.LeftDelim, i.RightDelim)
+	}
+	t, err := i.newTemplate(templName)
+	if err != nil {
+		return nil, err
+	}
+	t, err = t.Funcs(template.FuncMap(funcs)).Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(tracker.Writer(&buf), ctx)
+	if err := tracker.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resultEvaluated {
+		return res, nil
+	}
+	return buf.String(), nil
+}
+
+// newTemplate returns new empty template with given name, associated with
+// shared named templates, if there are any.
+func (i *HTMLInterpreter) newTemplate(name string) (*template.Template, error) {
+	left, right := delims(i.LeftDelim, i.RightDelim)
+	if len(i.Templates) == 0 && len(i.TemplateFiles) == 0 {
+		return template.New(name).Delims(left, right), nil
+	}
+	i.baseOnce.Do(func() {
+		base := template.New("").Delims(left, right).
+			Funcs(template.FuncMap(templateFuncs(i.Funcs, nil, nil, nil)))
+		for n, s := range i.Templates {
+			if _, err := base.New(fmt.Sprintf("Templates[%d]", n)).Parse(s); err != nil {
+				i.baseErr = err
+				return
+			}
+		}
+		for _, g := range i.TemplateFiles {
+			if _, err := base.ParseGlob(g); err != nil {
+				i.baseErr = err
+				return
+			}
+		}
+		i.base = base
+	})
+	if i.baseErr != nil {
+		return nil, i.baseErr
+	}
+	t, err := i.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return t.New(name), nil
+}
@@ -0,0 +1,144 @@
+package el
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Limits restricts resources, which can be consumed by a single expression.
+// Zero value of any field means no limit.
+type Limits struct {
+	// MaxEvalDepth limits depth of nested "eval" calls (expression, which
+	// evaluates expression, which evaluates expression...).
+	MaxEvalDepth int
+	// MaxOutput limits size of the rendered output of template in bytes.
+	// It's not applicable to interpreters, which do not render output.
+	MaxOutput int
+	// MaxCalls limits number of custom (and special) function calls within
+	// the single expression. Calls within nested "eval" expressions are
+	// counted separately, according to limits of their interpreter.
+	MaxCalls int
+}
+
+// LimitError is returned by interpreter, when expression exceeds one of
+// Limits.
+type LimitError struct {
+	// LongName of the field, which expression exceeded the limit.
+	Field string
+	// Name of the exceeded limit ("eval depth", "output" or "calls").
+	Limit string
+	// Value of the exceeded limit.
+	Max int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("<<%s>> %s limit (%d) exceeded", e.Field, e.Limit, e.Max)
+}
+
+// Tracker tracks resources, consumed by a single execution of expression,
+// according to Limits. Interpreters create new Tracker for every execution.
+//
+// Functions wrapped with Tracker panic with *LimitError, when limit of calls
+// is exceeded (to interrupt execution), so interpreter should check Err()
+// after execution and return it instead of error returned by underlying
+// engine.
+type Tracker struct {
+	limits Limits
+	ctx    *Context
+	calls  int
+	err    *LimitError
+}
+
+// NewTracker returns new Tracker of the expression execution within ctx.
+func (l Limits) NewTracker(ctx *Context) *Tracker {
+	return &Tracker{limits: l, ctx: ctx}
+}
+
+// Err returns error, if one of limits was exceeded (or nil).
+func (t *Tracker) Err() error {
+	if t == nil || t.err == nil {
+		return nil
+	}
+	return t.err
+}
+
+func (t *Tracker) fail(limit string, max int) *LimitError {
+	if t.err == nil {
+		t.err = &LimitError{t.ctx.LongName, limit, max}
+	}
+	return t.err
+}
+
+// Func returns function f, wrapped to count its calls. It returns f as is,
+// if there is no limit of calls or f is not a function.
+func (t *Tracker) Func(f interface{}) interface{} {
+	if t == nil || t.limits.MaxCalls <= 0 {
+		return f
+	}
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func {
+		return f
+	}
+	return reflect.MakeFunc(v.Type(), func(args []reflect.Value) []reflect.Value {
+		t.calls++
+		if t.calls > t.limits.MaxCalls {
+			panic(t.fail("calls", t.limits.MaxCalls))
+		}
+		if v.Type().IsVariadic() {
+			return v.CallSlice(args)
+		}
+		return v.Call(args)
+	}).Interface()
+}
+
+// Writer returns w, wrapped to limit size of the output. It returns w as
+// is, if there is no limit of output.
+func (t *Tracker) Writer(w io.Writer) io.Writer {
+	if t == nil || t.limits.MaxOutput <= 0 {
+		return w
+	}
+	return &limitedWriter{w, t, 0}
+}
+
+type limitedWriter struct {
+	w io.Writer
+	t *Tracker
+	n int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.n+len(p) > w.t.limits.MaxOutput {
+		return 0, w.t.fail("output", w.t.limits.MaxOutput)
+	}
+	n, err := w.w.Write(p)
+	w.n += n
+	return n, err
+}
+
+// CheckDepth returns *LimitError, if Context.EvalDepth exceeds the limit.
+// Interpreters call it before execution, so the limit is checked for every
+// nested expression, no matter how it was started ("eval", direct call of
+// Context.EvalExpr or custom function).
+func (t *Tracker) CheckDepth() error {
+	max := t.limits.MaxEvalDepth
+	if max > 0 && t.ctx.EvalDepth > max {
+		return t.fail("eval depth", max)
+	}
+	return nil
+}
+
+// Eval evaluates expression with given interpreter (see Context.EvalExpr),
+// checking depth of nested "eval" calls.
+func (t *Tracker) Eval(intrpr, expr string) (interface{}, error) {
+	max := t.limits.MaxEvalDepth
+	if max > 0 && t.ctx.EvalDepth >= max {
+		return nil, t.fail("eval depth", max)
+	}
+	res, err := t.ctx.EvalExpr(intrpr, expr, t.ctx)
+	if e, ok := err.(*LimitError); ok && t.err == nil {
+		// Propagate limit error of the nested expression as is.
+		t.err = e
+	}
+	return res, err
+}
@@ -0,0 +1,17 @@
+package el
+
+// Restrict returns function f, if it is allowed by ctx.CheckFunc (or if
+// ctx.CheckFunc is nil). Otherwise it returns a stub, which accepts any
+// arguments and returns an error, returned by ctx.CheckFunc.
+//
+// Interpreters use it to prevent calls of custom functions, which are not
+// allowed within the current context (see Context.CheckFunc).
+func (ctx *Context) Restrict(name string, f interface{}) interface{} {
+	if ctx == nil || ctx.CheckFunc == nil {
+		return f
+	}
+	if err := ctx.CheckFunc(name); err != nil {
+		return func(...interface{}) (interface{}, error) { return nil, err }
+	}
+	return f
+}
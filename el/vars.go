@@ -0,0 +1,46 @@
+package el
+
+import "fmt"
+
+// Vars is a scoped store of variables, which allows expressions to share
+// intermediate results within a single evaluation. Variable, defined in the
+// scope, is visible within this scope and all its nested scopes. Nested
+// scope can shadow variable with the same name.
+//
+// Vars is not safe for concurrent use.
+type Vars struct {
+	parent *Vars
+	vars   map[string]interface{}
+}
+
+// NewVars creates new scope of variables, nested into parent (can be nil).
+func NewVars(parent *Vars) *Vars {
+	return &Vars{parent: parent, vars: map[string]interface{}{}}
+}
+
+// Let defines variable within current scope.
+func (v *Vars) Let(name string, value interface{}) {
+	v.vars[name] = value
+}
+
+// Lookup searches variable within current and enclosing scopes.
+func (v *Vars) Lookup(name string) (interface{}, bool) {
+	for s := v; s != nil; s = s.parent {
+		if value, ok := s.vars[name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns value of the variable or error, if variable is not defined.
+func (v *Vars) Get(name string) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("var %s: no variables in context", name)
+	}
+	value, ok := v.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("var %s: undefined", name)
+	}
+	return value, nil
+}
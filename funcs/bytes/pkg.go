@@ -17,6 +17,13 @@ var Pkg = use.FuncMap{
 	"reader": bytes.NewReader,
 }
 
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
 func convert(v interface{}) []byte {
 	return reflect.ValueOf(v).Convert(reflect.TypeOf([]byte{})).Bytes()
 }
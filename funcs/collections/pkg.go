@@ -0,0 +1,504 @@
+package collections
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nikolay-turpitko/structor/el"
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// Pkg contains custom functions defined by this package.
+//
+// Functions accept lists (slices or arrays of any type, nil is an empty list)
+// and maps of any type. The processed list or map is always the last
+// argument, which is convenient with pipes in "text/template". Functions,
+// which select elements, return slice of the same type as their argument.
+//
+// Elements are compared by value, numbers of different types are compared
+// numerically. Order of sort is: numbers, then other values, compared as
+// strings (see fmt.Sprint()).
+var Pkg = use.FuncMap{
+	// func first(list interface{}) (interface{}, error)
+	// Returns the first element of the list, or nil for empty list.
+	"first": first,
+	// func last(list interface{}) (interface{}, error)
+	// Returns the last element of the list, or nil for empty list.
+	"last": last,
+	// func subslice(start, end int, list interface{}) (interface{}, error)
+	// Returns elements of the list from start to end (exclusive). Negative
+	// index counts from the end of the list. Indexes are silently clamped to
+	// the length of the list. It's not named "slice" to not hide builtin
+	// function of "text/template", when package is used without prefix.
+	"subslice": subslice,
+	// func filter(re string, list interface{}) (interface{}, error)
+	// Returns elements of the list, which string representation matches
+	// regular expression re.
+	"filter": filter,
+	// func map(f interface{}, args ...interface{}, list interface{}) ([]interface{}, error)
+	// Returns results of f for every element of the list. If f is a
+	// function, it's called with args and element (as the last argument).
+	// If f is a string, it's an expression, which is evaluated by the
+	// current interpreter with element in "Sub" field of context (for
+	// example, "{{.Sub | upper}}").
+	"map": mapList,
+	// func unique(list interface{}) (interface{}, error)
+	// Returns elements of the list without duplicates, preserving order.
+	"unique": unique,
+	// func sort(list interface{}) (interface{}, error)
+	// Returns sorted copy of the list.
+	"sort": sortList,
+	// func joinList(sep string, list interface{}) (string, error)
+	// Joins elements of the list (converted to strings with fmt.Sprint),
+	// placing sep between them.
+	"joinList": joinList,
+	// func keys(m interface{}) (interface{}, error)
+	// Returns sorted slice of keys of the map.
+	"keys": keys,
+	// func values(m interface{}) (interface{}, error)
+	// Returns slice of values of the map, ordered by keys.
+	"values": values,
+	// func dict(kv ...interface{}) (map[string]interface{}, error)
+	// Creates map from key-value pairs. Keys are converted to strings.
+	"dict": dict,
+	// func list(v ...interface{}) []interface{}
+	// Creates list of arguments.
+	"list": list,
+	// func has(item, c interface{}) (bool, error)
+	// Reports whether map c contains key item or list c contains element
+	// item.
+	"has": has,
+	// func default(def, v interface{}) interface{}
+	// Returns v, or def if v is empty (nil, false, 0, empty string, list or
+	// map).
+	"default": defaultValue,
+}
+
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+// toList returns v as a slice value (arrays are copied).
+func toList(name string, v interface{}) (reflect.Value, error) {
+	if v == nil {
+		return reflect.ValueOf([]interface{}{}), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		return rv, nil
+	case reflect.Array:
+		s := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), rv.Len(), rv.Len())
+		reflect.Copy(s, rv)
+		return s, nil
+	}
+	return reflect.Value{}, fmt.Errorf("%s: not a list: %T", name, v)
+}
+
+func toMap(name string, v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map {
+		return reflect.Value{}, fmt.Errorf("%s: not a map: %T", name, v)
+	}
+	return rv, nil
+}
+
+func first(l interface{}) (interface{}, error) {
+	s, err := toList("first", l)
+	if err != nil || s.Len() == 0 {
+		return nil, err
+	}
+	return s.Index(0).Interface(), nil
+}
+
+func last(l interface{}) (interface{}, error) {
+	s, err := toList("last", l)
+	if err != nil || s.Len() == 0 {
+		return nil, err
+	}
+	return s.Index(s.Len() - 1).Interface(), nil
+}
+
+func subslice(start, end int, l interface{}) (interface{}, error) {
+	s, err := toList("subslice", l)
+	if err != nil {
+		return nil, err
+	}
+	clamp := func(i int) int {
+		if i < 0 {
+			i += s.Len()
+		}
+		switch {
+		case i < 0:
+			return 0
+		case i > s.Len():
+			return s.Len()
+		}
+		return i
+	}
+	start, end = clamp(start), clamp(end)
+	if start > end {
+		start = end
+	}
+	return s.Slice(start, end).Interface(), nil
+}
+
+// selectElems returns slice of the same type as s with elements, for which
+// f returns true.
+func selectElems(s reflect.Value, f func(reflect.Value) bool) interface{} {
+	res := reflect.MakeSlice(s.Type(), 0, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		if e := s.Index(i); f(e) {
+			res = reflect.Append(res, e)
+		}
+	}
+	return res.Interface()
+}
+
+func filter(re string, l interface{}) (interface{}, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return nil, fmt.Errorf("filter: %v", err)
+	}
+	s, err := toList("filter", l)
+	if err != nil {
+		return nil, err
+	}
+	return selectElems(s, func(e reflect.Value) bool {
+		return r.MatchString(fmt.Sprint(e.Interface()))
+	}), nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func mapList(ctx *el.Context, f interface{}, args ...interface{}) ([]interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("map: no list")
+	}
+	s, err := toList("map", args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	args = args[:len(args)-1]
+	var apply func(e interface{}) (interface{}, error)
+	if expr, ok := f.(string); ok {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("map: arguments are not allowed with expression")
+		}
+		if ctx == nil || ctx.EvalExpr == nil {
+			return nil, fmt.Errorf("map: expressions are not supported within context")
+		}
+		apply = func(e interface{}) (interface{}, error) {
+			c := *ctx
+			c.Sub = e
+			return ctx.EvalExpr(ctx.TagName, expr, &c)
+		}
+	} else {
+		fv := reflect.ValueOf(el.BindContext(f, ctx))
+		if fv.Kind() != reflect.Func {
+			return nil, fmt.Errorf("map: not a function or expression: %T", f)
+		}
+		apply = func(e interface{}) (interface{}, error) {
+			a := make([]interface{}, 0, len(args)+1)
+			return call(fv, append(append(a, args...), e))
+		}
+	}
+	res := make([]interface{}, 0, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		r, err := apply(s.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("map: [%d]: %v", i, err)
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// call calls function f with args, converting them to types of parameters.
+// It returns the first result of f and error, if the last result of f is
+// non-nil error.
+func call(f reflect.Value, args []interface{}) (interface{}, error) {
+	t := f.Type()
+	if t.NumOut() == 0 || t.NumOut() > 2 ||
+		t.NumOut() == 2 && t.Out(1) != errorType {
+		return nil, fmt.Errorf("unsupported function type %s", t)
+	}
+	n := t.NumIn()
+	if t.IsVariadic() && len(args) < n-1 || !t.IsVariadic() && len(args) != n {
+		return nil, fmt.Errorf("wrong number of arguments for %s: %d", t, len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, a := range args {
+		pt := t.In(min(i, n-1))
+		if t.IsVariadic() && i >= n-1 {
+			pt = pt.Elem()
+		}
+		v := reflect.ValueOf(a)
+		switch {
+		case !v.IsValid():
+			v = reflect.Zero(pt)
+		case v.Type().AssignableTo(pt):
+		case v.Type().ConvertibleTo(pt) && sameKind(v.Kind(), pt.Kind()):
+			v = v.Convert(pt)
+		default:
+			return nil, fmt.Errorf("wrong type of argument %d for %s: %T", i, t, a)
+		}
+		in[i] = v
+	}
+	out := f.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	return out[0].Interface(), nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func sameKind(a, b reflect.Kind) bool {
+	return a == b || isNumber(a) && isNumber(b)
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// key returns value, which can be used as a map key to find duplicates of v.
+func key(v reflect.Value) interface{} {
+	if k, ok := number(v); ok {
+		return k
+	}
+	v = elem(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type().Comparable() {
+		return v.Interface()
+	}
+	return fmt.Sprintf("%#v", v.Interface())
+}
+
+// elem returns value, stored in interface v, or v itself.
+func elem(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Interface {
+		return v.Elem()
+	}
+	return v
+}
+
+// value returns v as interface{}, or nil for invalid value.
+func value(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// number returns numeric value of v as int64, uint64 or float64 (if it has
+// fraction or doesn't fit into integers).
+func number(v reflect.Value) (interface{}, bool) {
+	v = elem(v)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > 1<<63-1 {
+			return u, true
+		}
+		return int64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == float64(int64(f)) {
+			return int64(f), true
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+func toFloat(n interface{}) float64 {
+	switch v := n.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return n.(float64)
+}
+
+// less defines order of elements for sort and keys.
+func less(a, b reflect.Value) bool {
+	na, aok := number(a)
+	nb, bok := number(b)
+	switch {
+	case aok && bok:
+		ia, aint := na.(int64)
+		ib, bint := nb.(int64)
+		if aint && bint {
+			return ia < ib
+		}
+		return toFloat(na) < toFloat(nb)
+	case aok != bok:
+		return aok
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+func equal(a, b reflect.Value) bool {
+	if na, ok := number(a); ok {
+		nb, ok := number(b)
+		return ok && na == nb
+	}
+	return reflect.DeepEqual(value(elem(a)), value(elem(b)))
+}
+
+func unique(l interface{}) (interface{}, error) {
+	s, err := toList("unique", l)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[interface{}]bool{}
+	return selectElems(s, func(e reflect.Value) bool {
+		k := key(e)
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+		return true
+	}), nil
+}
+
+func sortList(l interface{}) (interface{}, error) {
+	s, err := toList("sort", l)
+	if err != nil {
+		return nil, err
+	}
+	res := reflect.MakeSlice(s.Type(), s.Len(), s.Len())
+	reflect.Copy(res, s)
+	sort.SliceStable(res.Interface(), func(i, j int) bool {
+		return less(res.Index(i), res.Index(j))
+	})
+	return res.Interface(), nil
+}
+
+func joinList(sep string, l interface{}) (string, error) {
+	s, err := toList("joinList", l)
+	if err != nil {
+		return "", err
+	}
+	res := make([]string, s.Len())
+	for i := range res {
+		res[i] = fmt.Sprint(s.Index(i).Interface())
+	}
+	return strings.Join(res, sep), nil
+}
+
+func sortedKeys(m reflect.Value) []reflect.Value {
+	k := m.MapKeys()
+	sort.Slice(k, func(i, j int) bool { return less(k[i], k[j]) })
+	return k
+}
+
+func keys(m interface{}) (interface{}, error) {
+	mv, err := toMap("keys", m)
+	if err != nil {
+		return nil, err
+	}
+	res := reflect.MakeSlice(reflect.SliceOf(mv.Type().Key()), 0, mv.Len())
+	res = reflect.Append(res, sortedKeys(mv)...)
+	return res.Interface(), nil
+}
+
+func values(m interface{}) (interface{}, error) {
+	mv, err := toMap("values", m)
+	if err != nil {
+		return nil, err
+	}
+	res := reflect.MakeSlice(reflect.SliceOf(mv.Type().Elem()), 0, mv.Len())
+	for _, k := range sortedKeys(mv) {
+		res = reflect.Append(res, mv.MapIndex(k))
+	}
+	return res.Interface(), nil
+}
+
+func dict(kv ...interface{}) (map[string]interface{}, error) {
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := make(map[string]interface{}, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		m[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	return m, nil
+}
+
+func list(v ...interface{}) []interface{} {
+	if v == nil {
+		return []interface{}{}
+	}
+	return v
+}
+
+func has(item, c interface{}) (bool, error) {
+	iv := reflect.ValueOf(item)
+	cv := reflect.ValueOf(c)
+	var elems []reflect.Value
+	switch cv.Kind() {
+	case reflect.Map:
+		elems = cv.MapKeys()
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < cv.Len(); i++ {
+			elems = append(elems, cv.Index(i))
+		}
+	case reflect.Invalid:
+		return false, nil
+	default:
+		return false, fmt.Errorf("has: not a list or map: %T", c)
+	}
+	for _, e := range elems {
+		if equal(e, iv) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return def
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		if rv.Len() == 0 {
+			return def
+		}
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		if rv.IsNil() {
+			return def
+		}
+	default:
+		if reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface()) {
+			return def
+		}
+	}
+	return v
+}
@@ -0,0 +1,328 @@
+package conv
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// Pkg contains custom functions defined by this package.
+//
+// Functions accept values of any basic type (including named types), strings
+// and json.Number, and return error, if value cannot be converted without
+// loss (like 1.5 to int, or 300 to uint8), instead of panic. They can be used
+// at the end of pipeline to make result type independent on the type of the
+// preceding function.
+var Pkg = use.FuncMap{
+	// func toInt(v interface{}) (int, error)
+	// Converts number, bool or string (decimal, or with "0x", "0o", "0b"
+	// prefix) to int.
+	"toInt": toInt,
+	// func toInt64(v interface{}) (int64, error)
+	// Like toInt, but returns int64.
+	"toInt64": toInt64,
+	// func toUint(v interface{}) (uint, error)
+	// Like toInt, but returns uint.
+	"toUint": toUint,
+	// func toFloat(v interface{}) (float64, error)
+	// Converts number, bool or string to float64.
+	"toFloat": toFloat,
+	// func toBool(v interface{}) (bool, error)
+	// Converts bool, number (non zero is true) or string ("1", "t", "true",
+	// "0", "f", "false", etc, see strconv.ParseBool) to bool.
+	"toBool": toBool,
+	// func toString(v interface{}) (string, error)
+	// Converts v to string. Values, which implement encoding.TextMarshaler or
+	// fmt.Stringer, are converted with them, []byte is converted as is, other
+	// values - with fmt.Sprint. Nil is converted to empty string.
+	"toString": toString,
+	// func toDuration(v interface{}) (time.Duration, error)
+	// Converts time.Duration, string (like "1h30m") or number (of seconds) to
+	// time.Duration.
+	"toDuration": toDuration,
+	// func toSlice(v interface{}) ([]interface{}, error)
+	// Converts slice or array of any type to []interface{}. Nil is converted
+	// to empty slice.
+	"toSlice": toSlice,
+	// func parseSize(v interface{}) (int64, error)
+	// Converts human readable size (like "10MiB", "1.5 GB" or "512") to
+	// number of bytes. Decimal ("kB", "MB", ... "EB") and binary ("KiB",
+	// "MiB", ... "EiB") units are supported, unit is case insensitive, "B" is
+	// optional ("10M" is the same as "10MB").
+	"parseSize": parseSize,
+}
+
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+func convError(name string, v interface{}, err error) error {
+	if err != nil {
+		return fmt.Errorf("conv: %s: cannot convert %T (%v): %v", name, v, v, err)
+	}
+	return fmt.Errorf("conv: %s: cannot convert %T (%v)", name, v, v)
+}
+
+// integer converts v to int64 (or uint64 for large unsigned values) and
+// reports whether value is unsigned and fits only into uint64.
+func integer(name string, v interface{}) (i int64, u uint64, big bool, err error) {
+	if n, ok := v.(json.Number); ok {
+		v = string(n)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), 0, false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return 0, u, true, nil
+		}
+		return int64(rv.Uint()), 0, false, nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, 0, false, convError(name, v, nil)
+		}
+		return int64(f), 0, false, nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, 0, false, nil
+		}
+		return 0, 0, false, nil
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		digits, base := splitBase(s)
+		i, err := strconv.ParseInt(digits, base, 64)
+		if err == nil {
+			return i, 0, false, nil
+		}
+		if u, err := strconv.ParseUint(digits, base, 64); err == nil {
+			return 0, u, true, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return integer(name, f)
+		}
+		return 0, 0, false, convError(name, v, err.(*strconv.NumError).Err)
+	}
+	return 0, 0, false, convError(name, v, nil)
+}
+
+// splitBase returns digits of the integer s (with sign, but without "0x",
+// "0o" or "0b" prefix) and its base. Prefixes are handled explicitly, because
+// strconv supports "0o" only since Go 1.13.
+func splitBase(s string) (string, int) {
+	sign := ""
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		sign, s = s[:1], s[1:]
+	}
+	if len(s) > 2 && s[0] == '0' && s[2] != '+' && s[2] != '-' {
+		switch s[1] {
+		case 'x', 'X':
+			return sign + s[2:], 16
+		case 'o', 'O':
+			return sign + s[2:], 8
+		case 'b', 'B':
+			return sign + s[2:], 2
+		}
+	}
+	return sign + s, 10
+}
+
+func toInt64(v interface{}) (int64, error) {
+	i, _, big, err := integer("toInt64", v)
+	if err == nil && big {
+		err = convError("toInt64", v, strconv.ErrRange)
+	}
+	return i, err
+}
+
+func toInt(v interface{}) (int, error) {
+	i, _, big, err := integer("toInt", v)
+	if err == nil && (big || int64(int(i)) != i) {
+		err = convError("toInt", v, strconv.ErrRange)
+	}
+	return int(i), err
+}
+
+func toUint(v interface{}) (uint, error) {
+	i, u, big, err := integer("toUint", v)
+	if err != nil {
+		return 0, err
+	}
+	if !big {
+		if i < 0 {
+			return 0, convError("toUint", v, strconv.ErrRange)
+		}
+		u = uint64(i)
+	}
+	if uint64(uint(u)) != u {
+		return 0, convError("toUint", v, strconv.ErrRange)
+	}
+	return uint(u), nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	if n, ok := v.(json.Number); ok {
+		v = string(n)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return 0, convError("toFloat", v, err.(*strconv.NumError).Err)
+		}
+		return f, nil
+	}
+	return 0, convError("toFloat", v, nil)
+}
+
+func toBool(v interface{}) (bool, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		b, err := strconv.ParseBool(strings.TrimSpace(rv.String()))
+		if err != nil {
+			return false, convError("toBool", v, err.(*strconv.NumError).Err)
+		}
+		return b, nil
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return false, convError("toBool", v, nil)
+	}
+	return f != 0, nil
+}
+
+func toString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	case encoding.TextMarshaler:
+		b, err := s.MarshalText()
+		if err != nil {
+			return "", convError("toString", v, err)
+		}
+		return string(b), nil
+	case fmt.Stringer:
+		return s.String(), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.String {
+		return rv.String(), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+func toDuration(v interface{}) (time.Duration, error) {
+	if d, ok := v.(time.Duration); ok {
+		return d, nil
+	}
+	if reflect.ValueOf(v).Kind() == reflect.String {
+		s := strings.TrimSpace(reflect.ValueOf(v).String())
+		d, err := time.ParseDuration(s)
+		if err == nil {
+			return d, nil
+		}
+		if _, ferr := strconv.ParseFloat(s, 64); ferr != nil {
+			return 0, convError("toDuration", v, err)
+		}
+	}
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, convError("toDuration", v, nil)
+	}
+	d := f * float64(time.Second)
+	if d < math.MinInt64 || d >= math.MaxInt64 {
+		return 0, convError("toDuration", v, strconv.ErrRange)
+	}
+	return time.Duration(d), nil
+}
+
+func toSlice(v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		res := make([]interface{}, rv.Len())
+		for i := range res {
+			res[i] = rv.Index(i).Interface()
+		}
+		return res, nil
+	}
+	return nil, convError("toSlice", v, nil)
+}
+
+var sizeUnits = map[string]float64{
+	"":   1,
+	"k":  1e3,
+	"m":  1e6,
+	"g":  1e9,
+	"t":  1e12,
+	"p":  1e15,
+	"e":  1e18,
+	"ki": 1 << 10,
+	"mi": 1 << 20,
+	"gi": 1 << 30,
+	"ti": 1 << 40,
+	"pi": 1 << 50,
+	"ei": 1 << 60,
+}
+
+func parseSize(v interface{}) (int64, error) {
+	if reflect.ValueOf(v).Kind() != reflect.String {
+		return toInt64(v)
+	}
+	s := strings.TrimSpace(reflect.ValueOf(v).String())
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, convError("parseSize", v, err.(*strconv.NumError).Err)
+	}
+	unit := strings.TrimSpace(s[i:])
+	mul, ok := sizeUnits[strings.TrimSuffix(strings.ToLower(unit), "b")]
+	if !ok {
+		return 0, convError("parseSize", v, fmt.Errorf("unknown unit %q", unit))
+	}
+	size := n * mul
+	if size >= math.MaxInt64 {
+		return 0, convError("parseSize", v, strconv.ErrRange)
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,153 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/nikolay-turpitko/structor/funcs/internal/source"
+)
+
+// keySize is a size of keys, derived by "pbkdf2" and "hkdf" (suitable for
+// "aes"/"unaes").
+const keySize = 32
+
+// hashes maps names of hash algorithms, accepted by "hmac", to constructors.
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// toBytes converts string or []byte to []byte.
+func toBytes(name string, v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+	return nil, fmt.Errorf("crypt: %s: string or []byte expected, got %T", name, v)
+}
+
+// digest calculates checksum of the src, reading it by chunks.
+func digest(h hash.Hash, src interface{}) ([]byte, error) {
+	r, _, err := source.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func sum(newHash func() hash.Hash) func(interface{}) ([]byte, error) {
+	return func(src interface{}) ([]byte, error) {
+		return digest(newHash(), src)
+	}
+}
+
+// encoded returns function, which encodes result of f into string.
+func encoded(
+	encode func([]byte) string,
+	f func(interface{}) ([]byte, error)) func(interface{}) (string, error) {
+	return func(src interface{}) (string, error) {
+		b, err := f(src)
+		if err != nil {
+			return "", err
+		}
+		return encode(b), nil
+	}
+}
+
+func hexSum(newHash func() hash.Hash) func(interface{}) (string, error) {
+	return encoded(hex.EncodeToString, sum(newHash))
+}
+
+func base64Sum(newHash func() hash.Hash) func(interface{}) (string, error) {
+	return encoded(base64.StdEncoding.EncodeToString, sum(newHash))
+}
+
+func hmacSum(alg string, key, src interface{}) ([]byte, error) {
+	newHash, ok := hashes[alg]
+	if !ok {
+		return nil, fmt.Errorf("crypt: hmac: unknown algorithm %q", alg)
+	}
+	k, err := toBytes("hmac", key)
+	if err != nil {
+		return nil, err
+	}
+	return digest(hmac.New(newHash, k), src)
+}
+
+func hmacHex(alg string, key, src interface{}) (string, error) {
+	return encoded(hex.EncodeToString, func(src interface{}) ([]byte, error) {
+		return hmacSum(alg, key, src)
+	})(src)
+}
+
+func hmacBase64(alg string, key, src interface{}) (string, error) {
+	return encoded(base64.StdEncoding.EncodeToString, func(src interface{}) ([]byte, error) {
+		return hmacSum(alg, key, src)
+	})(src)
+}
+
+func secureEqual(a, b interface{}) (bool, error) {
+	x, err := toBytes("secureEqual", a)
+	if err != nil {
+		return false, err
+	}
+	y, err := toBytes("secureEqual", b)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(x, y) == 1, nil
+}
+
+func pbkdf2Key(salt interface{}, iter int, pass interface{}) ([]byte, error) {
+	if iter < 1 {
+		return nil, fmt.Errorf("crypt: pbkdf2: invalid number of iterations %d", iter)
+	}
+	s, err := toBytes("pbkdf2", salt)
+	if err != nil {
+		return nil, err
+	}
+	p, err := toBytes("pbkdf2", pass)
+	if err != nil {
+		return nil, err
+	}
+	return pbkdf2.Key(p, s, iter, keySize, sha256.New), nil
+}
+
+func hkdfKey(salt, info, secret interface{}) ([]byte, error) {
+	s, err := toBytes("hkdf", salt)
+	if err != nil {
+		return nil, err
+	}
+	i, err := toBytes("hkdf", info)
+	if err != nil {
+		return nil, err
+	}
+	sec, err := toBytes("hkdf", secret)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sec, s, i), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
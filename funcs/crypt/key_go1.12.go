@@ -0,0 +1,10 @@
+//go:build !go1.13
+// +build !go1.13
+
+package crypt
+
+// normalizeKey returns k as is ("crypto/x509" does not support ed25519 keys
+// before Go 1.13).
+func normalizeKey(k interface{}) interface{} {
+	return k
+}
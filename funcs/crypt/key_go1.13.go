@@ -0,0 +1,23 @@
+//go:build go1.13
+// +build go1.13
+
+package crypt
+
+import (
+	stded25519 "crypto/ed25519"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// normalizeKey converts ed25519 keys of the standard library (returned by
+// "crypto/x509" since Go 1.13) to keys of "golang.org/x/crypto/ed25519" (they
+// are the same types in its recent versions).
+func normalizeKey(k interface{}) interface{} {
+	switch k := k.(type) {
+	case stded25519.PrivateKey:
+		return ed25519.PrivateKey(k)
+	case stded25519.PublicKey:
+		return ed25519.PublicKey(k)
+	}
+	return k
+}
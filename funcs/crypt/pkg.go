@@ -1,9 +1,10 @@
 package crypt
 
 import (
-	"bytes"
 	"crypto/md5"
-	"io"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"strings"
 
 	"github.com/gtank/cryptopasta"
@@ -12,13 +13,79 @@ import (
 )
 
 // Pkg contains custom functions defined by this package.
+//
+// Functions, which process data, accept it as io.Reader, string or []byte
+// (src). Data is read by chunks, when possible. Keys, salts and signatures
+// are accepted as string or []byte.
 var Pkg = use.FuncMap{
 	// func rot13(s string) string
 	// Performs simple rot13 obfuscation.
 	"rot13": rot13,
-	// func md5(r io.Reader) ([]byte, error)
-	// Calculates md5 checksum of io.Reader's content and returns it as []byte.
-	"md5": md5Sum,
+	// func md5(src interface{}) ([]byte, error)
+	// Calculates md5 checksum of the src and returns it as []byte.
+	"md5": sum(md5.New),
+	// func sha1(src interface{}) ([]byte, error)
+	// Calculates sha1 checksum of the src and returns it as []byte.
+	"sha1": sum(sha1.New),
+	// func sha256(src interface{}) ([]byte, error)
+	// Calculates sha256 checksum of the src and returns it as []byte.
+	"sha256": sum(sha256.New),
+	// func sha512(src interface{}) ([]byte, error)
+	// Calculates sha512 checksum of the src and returns it as []byte.
+	"sha512": sum(sha512.New),
+	// func md5Hex(src interface{}) (string, error)
+	// Functions with "Hex" and "Base64" suffixes are the same as above, but
+	// return checksum, encoded as hex or standard base64 string.
+	"md5Hex":       hexSum(md5.New),
+	"md5Base64":    base64Sum(md5.New),
+	"sha1Hex":      hexSum(sha1.New),
+	"sha1Base64":   base64Sum(sha1.New),
+	"sha256Hex":    hexSum(sha256.New),
+	"sha256Base64": base64Sum(sha256.New),
+	"sha512Hex":    hexSum(sha512.New),
+	"sha512Base64": base64Sum(sha512.New),
+	// func hmac(alg string, key, src interface{}) ([]byte, error)
+	// Calculates HMAC of the src, using hash algorithm alg ("md5", "sha1",
+	// "sha256" or "sha512") and key.
+	"hmac": hmacSum,
+	// func hmacHex(alg string, key, src interface{}) (string, error)
+	// Like hmac, but returns result, encoded as hex string.
+	"hmacHex": hmacHex,
+	// func hmacBase64(alg string, key, src interface{}) (string, error)
+	// Like hmac, but returns result, encoded as standard base64 string.
+	"hmacBase64": hmacBase64,
+	// func secureEqual(a, b interface{}) (bool, error)
+	// Compares a and b in constant time (to compare checksums or HMACs).
+	// See "crypto/subtle".ConstantTimeCompare().
+	"secureEqual": secureEqual,
+	// func pbkdf2(salt interface{}, iter int, pass interface{}) ([]byte, error)
+	// Derives key for "aes"/"unaes" from the passphrase, using PBKDF2 with
+	// sha256 and iter iterations. See "golang.org/x/crypto/pbkdf2".Key().
+	"pbkdf2": pbkdf2Key,
+	// func hkdf(salt, info, secret interface{}) ([]byte, error)
+	// Derives key for "aes"/"unaes" from the secret, using HKDF with sha256.
+	// See "golang.org/x/crypto/hkdf".New().
+	"hkdf": hkdfKey,
+	// func privateKey(src interface{}) (crypto.PrivateKey, error)
+	// Parses PEM encoded private key ("PRIVATE KEY" in PKCS #8 or "EC PRIVATE
+	// KEY" in SEC 1 form). PEM encoded keys (here and in other functions) are
+	// accepted as string, []byte or io.Reader.
+	"privateKey": privateKey,
+	// func publicKey(src interface{}) (crypto.PublicKey, error)
+	// Parses PEM encoded public key ("PUBLIC KEY" in PKIX form) or returns
+	// public key of the private key (parsed or PEM encoded).
+	"publicKey": publicKey,
+	// func sign(key, src interface{}) ([]byte, error)
+	// Signs the src with ed25519 or ECDSA private key (parsed or PEM encoded).
+	// ECDSA signs sha256, sha384 or sha512 checksum of the src (depending on
+	// the curve size) and returns ASN.1 encoded signature.
+	// PEM encoded (PKCS #8) ed25519 keys are supported since Go 1.13.
+	"sign": sign,
+	// func verify(key, sig, src interface{}) (bool, error)
+	// Reports whether sig is a valid signature of the src, made by "sign".
+	// Key is ed25519 or ECDSA public key, or private key (parsed or PEM
+	// encoded).
+	"verify": verify,
 	// func rndKey() []byte
 	// Returns random encryption key for "aes"/"unaes".
 	// See "github.com/gtank/cryptopasta".NewEncryptionKey().
@@ -31,6 +98,40 @@ var Pkg = use.FuncMap{
 	"unaes": unaes,
 }
 
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps contains capabilities of functions of this package.
+var Caps = use.Capabilities{
+	"md5":          {use.Crypto},
+	"sha1":         {use.Crypto},
+	"sha256":       {use.Crypto},
+	"sha512":       {use.Crypto},
+	"md5Hex":       {use.Crypto},
+	"md5Base64":    {use.Crypto},
+	"sha1Hex":      {use.Crypto},
+	"sha1Base64":   {use.Crypto},
+	"sha256Hex":    {use.Crypto},
+	"sha256Base64": {use.Crypto},
+	"sha512Hex":    {use.Crypto},
+	"sha512Base64": {use.Crypto},
+	"hmac":         {use.Crypto},
+	"hmacHex":      {use.Crypto},
+	"hmacBase64":   {use.Crypto},
+	"secureEqual":  {use.Crypto},
+	"pbkdf2":       {use.Crypto},
+	"hkdf":         {use.Crypto},
+	"privateKey":   {use.Crypto},
+	"publicKey":    {use.Crypto},
+	"sign":         {use.Crypto},
+	"verify":       {use.Crypto},
+	"rndKey":       {use.Crypto},
+	"aes":          {use.Crypto},
+	"unaes":        {use.Crypto},
+	"rot13":        {},
+}
+
 func rot13(s string) string { return strings.Map(mapRot13, s) }
 
 func mapRot13(r rune) rune {
@@ -48,20 +149,6 @@ func mapRot13(r rune) rune {
 	return r
 }
 
-func md5Sum(r io.Reader) ([]byte, error) {
-	h := md5.New()
-	var b bytes.Buffer
-	_, err := io.Copy(&b, r)
-	if err != nil {
-		return nil, err
-	}
-	_, err = h.Write(b.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	return h.Sum(nil), nil
-}
-
 func rndKey() []byte {
 	k := cryptopasta.NewEncryptionKey()
 	key := make([]byte, 32)
@@ -0,0 +1,183 @@
+package crypt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/nikolay-turpitko/structor/funcs/internal/source"
+)
+
+// readPEM returns the first PEM block of the src.
+func readPEM(name string, src interface{}) (*pem.Block, error) {
+	r, _, err := source.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("crypt: %s: no PEM data found", name)
+	}
+	return block, nil
+}
+
+func privateKey(src interface{}) (crypto.PrivateKey, error) {
+	block, err := readPEM("privateKey", src)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrivateKey("privateKey", block)
+}
+
+// parsePrivateKey parses private key from the decoded PEM block.
+func parsePrivateKey(name string, block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("crypt: %s: unsupported PEM block %q", name, block.Type)
+}
+
+func publicKey(src interface{}) (crypto.PublicKey, error) {
+	if k, ok := src.(crypto.Signer); ok {
+		return k.Public(), nil
+	}
+	block, err := readPEM("publicKey", src)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY", "EC PRIVATE KEY":
+		k, err := parsePrivateKey("publicKey", block)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := k.(crypto.Signer); ok {
+			return s.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("crypt: publicKey: unsupported PEM block %q", block.Type)
+}
+
+// signingKey returns key itself or key, parsed from PEM.
+func signingKey(key interface{}) (crypto.PrivateKey, error) {
+	switch key.(type) {
+	case string, []byte, io.Reader:
+		return privateKey(key)
+	}
+	return key, nil
+}
+
+// verificationKey returns key itself, public part of the private key or
+// key, parsed from PEM.
+func verificationKey(key interface{}) (crypto.PublicKey, error) {
+	switch key.(type) {
+	case string, []byte, io.Reader, crypto.Signer:
+		return publicKey(key)
+	}
+	return key, nil
+}
+
+// ecdsaHash returns hash, appropriate for the size of the curve.
+func ecdsaHash(k *ecdsa.PublicKey) hash.Hash {
+	switch bits := k.Curve.Params().BitSize; {
+	case bits <= 256:
+		return sha256.New()
+	case bits <= 384:
+		return sha512.New384()
+	}
+	return sha512.New()
+}
+
+// ecdsaSignature is an ASN.1 encoded ECDSA signature (the same, as produced by
+// ecdsa.SignASN1 since Go 1.15).
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func readAll(src interface{}) ([]byte, error) {
+	r, _, err := source.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func sign(key, src interface{}) ([]byte, error) {
+	k, err := signingKey(key)
+	if err != nil {
+		return nil, err
+	}
+	switch k := normalizeKey(k).(type) {
+	case ed25519.PrivateKey:
+		msg, err := readAll(src)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.Sign(k, msg), nil
+	case *ecdsa.PrivateKey:
+		d, err := digest(ecdsaHash(&k.PublicKey), src)
+		if err != nil {
+			return nil, err
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, d)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(ecdsaSignature{r, s})
+	}
+	return nil, fmt.Errorf("crypt: sign: unsupported key type %T", k)
+}
+
+func verify(key, sig, src interface{}) (bool, error) {
+	k, err := verificationKey(key)
+	if err != nil {
+		return false, err
+	}
+	s, err := toBytes("verify", sig)
+	if err != nil {
+		return false, err
+	}
+	switch k := normalizeKey(k).(type) {
+	case ed25519.PublicKey:
+		msg, err := readAll(src)
+		if err != nil {
+			return false, err
+		}
+		return ed25519.Verify(k, msg, s), nil
+	case *ecdsa.PublicKey:
+		d, err := digest(ecdsaHash(k), src)
+		if err != nil {
+			return false, err
+		}
+		var es ecdsaSignature
+		if rest, err := asn1.Unmarshal(s, &es); err != nil || len(rest) > 0 {
+			return false, nil
+		}
+		if es.R == nil || es.S == nil {
+			return false, nil
+		}
+		return ecdsa.Verify(k, d, es.R, es.S), nil
+	}
+	return false, fmt.Errorf("crypt: verify: unsupported key type %T", k)
+}
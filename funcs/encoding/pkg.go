@@ -14,3 +14,10 @@ var Pkg = use.FuncMap{
 	"hex":      hex.EncodeToString,
 	"unhex":    hex.DecodeString,
 }
+
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
@@ -1,13 +1,25 @@
 package funcs_test
 
 import (
+	gostrings "strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/nikolay-turpitko/structor/funcs/bytes"
+	"github.com/nikolay-turpitko/structor/funcs/collections"
+	"github.com/nikolay-turpitko/structor/funcs/conv"
+	"github.com/nikolay-turpitko/structor/funcs/crypt"
+	"github.com/nikolay-turpitko/structor/funcs/encoding"
+	"github.com/nikolay-turpitko/structor/funcs/goquery"
+	"github.com/nikolay-turpitko/structor/funcs/json"
 	"github.com/nikolay-turpitko/structor/funcs/math"
+	"github.com/nikolay-turpitko/structor/funcs/os"
+	"github.com/nikolay-turpitko/structor/funcs/regexp"
 	"github.com/nikolay-turpitko/structor/funcs/strings"
+	"github.com/nikolay-turpitko/structor/funcs/time"
 	"github.com/nikolay-turpitko/structor/funcs/use"
+	"github.com/nikolay-turpitko/structor/funcs/xpath"
 )
 
 func TestProvide(t *testing.T) {
@@ -26,3 +38,75 @@ func TestProvide(t *testing.T) {
 	assert.Contains(t, ff, "add")
 	assert.Contains(t, ff, "split")
 }
+
+func TestCaps(t *testing.T) {
+	caps := use.PackagesCaps(
+		strings.Package,
+		use.Pkg{Prefix: "o_", MapName: gostrings.ToUpper, Funcs: os.Pkg, Caps: os.Caps},
+		os.Exec{}.Package().WithPrefix("x_"),
+		use.Pkg{Prefix: "u_", Funcs: os.Pkg},
+	)
+	assert.Equal(t, []use.Capability{use.Env}, caps["o_ENV"])
+	assert.Equal(t, []use.Capability{use.Exec}, caps["x_exec"])
+	assert.NotContains(t, caps, "x_env")
+	assert.NotContains(t, caps, "u_env")
+	assert.Empty(t, caps["split"])
+	assert.True(t, caps.Allowed("split"))
+	assert.False(t, caps.Allowed("unknown"))
+	assert.False(t, caps.Allowed("u_env", use.Env))
+	assert.True(t, caps.Allowed("o_OPEN", use.FS, use.Env))
+	assert.False(t, caps.Allowed("o_OPEN", use.Env))
+	assert.False(t, caps.Allowed("x_exec"))
+}
+
+// TestPackagesCaps checks, that every function of every package is labeled
+// with capabilities, so it's not denied as unknown.
+func TestPackagesCaps(t *testing.T) {
+	for _, p := range []use.Pkg{
+		bytes.Package,
+		collections.Package,
+		conv.Package,
+		crypt.Package,
+		encoding.Package,
+		goquery.Package,
+		json.Package,
+		math.Package,
+		os.Package,
+		os.Exec{}.Package(),
+		regexp.Package,
+		strings.Package,
+		time.Package,
+		xpath.Package,
+	} {
+		for nm := range p.Funcs {
+			assert.Contains(t, p.Caps, nm)
+		}
+	}
+}
+
+// TestNoNameClash checks, that packages can be combined without prefixes
+// (except of "bytes", which mirrors "strings").
+func TestNoNameClash(t *testing.T) {
+	names := map[string]int{}
+	for _, p := range []use.FuncMap{
+		collections.Pkg,
+		conv.Pkg,
+		crypt.Pkg,
+		encoding.Pkg,
+		goquery.Pkg,
+		json.Pkg,
+		math.Pkg,
+		os.Pkg,
+		regexp.Pkg,
+		strings.Pkg,
+		time.Pkg,
+		xpath.Pkg,
+	} {
+		for nm := range p {
+			names[nm]++
+		}
+	}
+	for nm, n := range names {
+		assert.Equal(t, 1, n, nm)
+	}
+}
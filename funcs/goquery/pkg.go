@@ -1,26 +1,218 @@
 package goquery
 
 import (
-	"io"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 
+	"github.com/nikolay-turpitko/structor/el"
+	"github.com/nikolay-turpitko/structor/funcs/internal/source"
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 // Pkg contains custom functions defined by this package.
+//
+// Functions accept source of the HTML document as io.Reader, string, []byte
+// or document, parsed by "goqueryDoc" (*goquery.Document). Parsed documents
+// are cached within evaluation by source (content of string or []byte, or
+// io.Reader itself), so every source is parsed only once and the same
+// io.Reader can be used by several expressions.
+//
+// Helper functions ("text", "attr", etc) accept selector and src, like
+// "goquery", and return plain values. Src can also be a *goquery.Selection
+// (returned by "goquery", "firstMatch" or "nth"), empty selector selects src
+// itself. Text is returned with normalized whitespaces (sequences of white
+// space characters are replaced with single space, leading and trailing
+// spaces are removed).
+//
+// Functions take *el.Context as the first argument, which is bound by
+// interpreter (see "github.com/nikolay-turpitko/structor/el".BindContext()),
+// so it's omitted in expressions. When called from Go code, nil context can
+// be passed (documents are not cached then).
 var Pkg = use.FuncMap{
-	// func goquery(selector string, r io.Reader) (*goquery.Selection, error)
-	// Finds selector in the HTML document, represented by r.
+	// func goqueryDoc(src interface{}) (*goquery.Document, error)
+	// Parses HTML document, represented by src. Result can be stored (in
+	// variable, for example) and passed to other functions of this package.
+	// See "github.com/PuerkitoBio/goquery".NewDocumentFromReader().
+	"goqueryDoc": parseDoc,
+	// func goquery(selector string, src interface{}) (*goquery.Selection, error)
+	// Finds selector in the HTML document, represented by src. Src can also
+	// be a *goquery.Selection to search within it.
 	// See "github.com/PuerkitoBio/goquery".NewDocumentFromReader() and
 	// "github.com/PuerkitoBio/goquery".Find().
 	"goquery": goQuery,
+	// func text(selector string, src interface{}) (string, error)
+	// Returns combined text of all matched elements.
+	"text": text,
+	// func texts(selector string, src interface{}) ([]string, error)
+	// Returns text of every matched element.
+	"texts": texts,
+	// func attr(name, selector string, src interface{}) (string, error)
+	// Returns value of the attribute of the first matched element, or empty
+	// string.
+	"attr": attr,
+	// func attrs(name, selector string, src interface{}) ([]string, error)
+	// Returns values of the attribute of all matched elements, which have it.
+	"attrs": attrs,
+	// func innerHTML(selector string, src interface{}) (string, error)
+	// Returns inner HTML of the first matched element.
+	"innerHTML": innerHTML,
+	// func count(selector string, src interface{}) (int, error)
+	// Returns number of matched elements.
+	"count": count,
+	// func hasMatch(selector string, src interface{}) (bool, error)
+	// Reports whether selector matches any element.
+	"hasMatch": hasMatch,
+	// func firstMatch(selector string, src interface{}) (*goquery.Selection, error)
+	// Returns the first matched element.
+	"firstMatch": firstMatch,
+	// func nth(index int, selector string, src interface{}) (*goquery.Selection, error)
+	// Returns matched element by index (negative index counts from the end).
+	"nth": nth,
 }
 
-func goQuery(selector string, r io.Reader) (*goquery.Selection, error) {
-	doc, err := goquery.NewDocumentFromReader(r)
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+type docKey struct{ key interface{} }
+
+func parseDoc(ctx *el.Context, src interface{}) (*goquery.Document, error) {
+	if d, ok := src.(*goquery.Document); ok {
+		return d, nil
+	}
+	r, key, err := source.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return goquery.NewDocumentFromReader(r)
+	}
+	d, err := ctx.Cached(docKey{key}, func() (interface{}, error) {
+		return goquery.NewDocumentFromReader(r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.(*goquery.Document), nil
+}
+
+func goQuery(
+	ctx *el.Context,
+	selector string,
+	src interface{}) (*goquery.Selection, error) {
+	if s, ok := src.(*goquery.Selection); ok {
+		return s.Find(selector), nil
+	}
+	doc, err := parseDoc(ctx, src)
 	if err != nil {
 		return nil, err
 	}
 	return doc.Find(selector), nil
 }
+
+// selection returns elements, matched by selector within src, or src itself,
+// if selector is empty.
+func selection(
+	ctx *el.Context,
+	selector string,
+	src interface{}) (*goquery.Selection, error) {
+	if selector == "" {
+		switch s := src.(type) {
+		case *goquery.Selection:
+			return s, nil
+		case *goquery.Document:
+			return s.Selection, nil
+		}
+		doc, err := parseDoc(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		return doc.Selection, nil
+	}
+	return goQuery(ctx, selector, src)
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func text(ctx *el.Context, selector string, src interface{}) (string, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return "", err
+	}
+	return normalize(s.Text()), nil
+}
+
+func texts(ctx *el.Context, selector string, src interface{}) ([]string, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return nil, err
+	}
+	return s.Map(func(_ int, s *goquery.Selection) string {
+		return normalize(s.Text())
+	}), nil
+}
+
+func attr(ctx *el.Context, name, selector string, src interface{}) (string, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return "", err
+	}
+	return s.AttrOr(name, ""), nil
+}
+
+func attrs(ctx *el.Context, name, selector string, src interface{}) ([]string, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	s.Each(func(_ int, s *goquery.Selection) {
+		if v, ok := s.Attr(name); ok {
+			res = append(res, v)
+		}
+	})
+	return res, nil
+}
+
+func innerHTML(ctx *el.Context, selector string, src interface{}) (string, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return "", err
+	}
+	return s.Html()
+}
+
+func count(ctx *el.Context, selector string, src interface{}) (int, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return 0, err
+	}
+	return s.Length(), nil
+}
+
+func hasMatch(ctx *el.Context, selector string, src interface{}) (bool, error) {
+	n, err := count(ctx, selector, src)
+	return n > 0, err
+}
+
+func firstMatch(ctx *el.Context, selector string, src interface{}) (*goquery.Selection, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return nil, err
+	}
+	return s.First(), nil
+}
+
+func nth(ctx *el.Context, index int, selector string, src interface{}) (*goquery.Selection, error) {
+	s, err := selection(ctx, selector, src)
+	if err != nil {
+		return nil, err
+	}
+	return s.Eq(index), nil
+}
@@ -0,0 +1,33 @@
+/*
+Package source provides helpers for custom functions, which accept source
+of the document in different forms.
+*/
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Open returns io.Reader for the source (io.Reader, string or []byte) and
+// the key, identifying the source to cache parsed document within
+// evaluation. For string and []byte key is their content, for io.Reader it is
+// the reader itself (if it's comparable, nil otherwise). So, the same reader
+// can be used by several expressions, though it can be read only once.
+func Open(src interface{}) (io.Reader, interface{}, error) {
+	switch s := src.(type) {
+	case string:
+		return strings.NewReader(s), s, nil
+	case []byte:
+		return bytes.NewReader(s), string(s), nil
+	case io.Reader:
+		if reflect.TypeOf(s).Comparable() {
+			return s, s, nil
+		}
+		return s, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported source type: %T", src)
+}
@@ -0,0 +1,292 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nikolay-turpitko/structor/el"
+	"github.com/nikolay-turpitko/structor/funcs/internal/source"
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// Pkg contains custom functions defined by this package.
+//
+// Functions accept source of the JSON document as io.Reader, string or
+// []byte. Parsed documents are cached within evaluation by source (content
+// of string or []byte, or io.Reader itself), so every source is parsed only
+// once and the same io.Reader can be used by several expressions. Note, that
+// cached documents are shared, so they should not be modified.
+//
+// Context argument of functions ("parseJSON", "jsonpath", "decodeJSON") is
+// bound by interpreter (see "github.com/nikolay-turpitko/structor/el".BindContext())
+// and omitted in expressions.
+var Pkg = use.FuncMap{
+	// func parseJSON(src interface{}) (interface{}, error)
+	// Parses JSON document into generic value (map[string]interface{},
+	// []interface{}, json.Number, string, bool or nil). Numbers are kept as
+	// json.Number to not lose precision (see "conv" functions to convert
+	// them).
+	"parseJSON": parseJSON,
+	// func toJSON(v interface{}) (string, error)
+	// Encodes v into JSON.
+	"toJSON": toJSON,
+	// func toPrettyJSON(v interface{}) (string, error)
+	// Encodes v into indented JSON.
+	"toPrettyJSON": toPrettyJSON,
+	// func jsonpath(path string, src interface{}) (interface{}, error)
+	// Returns value, selected by JSONPath-like path from src (JSON document
+	// or already parsed value, including structs with "json" tags).
+	//
+	// Supported syntax: root "$", child ".name" or "['name']", index "[0]"
+	// (negative index counts from the end) and wildcard ".*" or "[*]".
+	// Path with wildcard returns []interface{} of all matched values (probably
+	// empty), otherwise it returns single value or error, if it's not found.
+	"jsonpath": jsonpath,
+	// func decodeJSON(src interface{}) (interface{}, error)
+	// Decodes JSON document into value of the type of the currently processed
+	// field (see "github.com/nikolay-turpitko/structor/el".Context.Type).
+	// Pointer fields get pointer to the decoded value.
+	"decodeJSON": decodeJSON,
+}
+
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+type docKey struct{ key interface{} }
+
+func parseJSON(ctx *el.Context, src interface{}) (interface{}, error) {
+	r, key, err := source.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	parse := func() (interface{}, error) {
+		var v interface{}
+		if err := decode(r, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if key == nil {
+		return parse()
+	}
+	return ctx.Cached(docKey{key}, parse)
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func toPrettyJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	return string(b), err
+}
+
+// decode decodes single JSON value from r into v, rejecting any data after
+// it. Numbers are decoded into json.Number.
+func decode(r io.Reader, v interface{}) error {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after top-level value")
+	}
+	return nil
+}
+
+func decodeJSON(ctx *el.Context, src interface{}) (interface{}, error) {
+	r, _, err := source.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	var t reflect.Type
+	if ctx != nil {
+		t = ctx.Type
+	}
+	if t == nil {
+		t = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	v := reflect.New(t)
+	if err := decode(r, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+func jsonpath(ctx *el.Context, path string, src interface{}) (interface{}, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	switch src.(type) {
+	case string, []byte, io.Reader:
+		if src, err = parseJSON(ctx, src); err != nil {
+			return nil, err
+		}
+	}
+	nodes := []interface{}{src}
+	multi := false
+	for i, s := range steps {
+		multi = multi || s.wildcard
+		next := []interface{}{}
+		for _, n := range nodes {
+			found, err := s.apply(n)
+			if err != nil && !multi {
+				return nil, fmt.Errorf("jsonpath %s: %s: %v", path, pathPrefix(steps[:i+1]), err)
+			}
+			next = append(next, found...)
+		}
+		nodes = next
+	}
+	if multi {
+		return nodes, nil
+	}
+	return nodes[0], nil
+}
+
+// step is a single step of the path: child by key, element by index or
+// wildcard.
+type step struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func (s step) String() string {
+	switch {
+	case s.wildcard:
+		return "[*]"
+	case s.isIndex:
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return "." + s.key
+}
+
+func pathPrefix(steps []step) string {
+	p := "$"
+	for _, s := range steps {
+		p += s.String()
+	}
+	return p
+}
+
+func parsePath(path string) ([]step, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("jsonpath %s: must start with $", path)
+	}
+	steps := []step{}
+	p := path[1:]
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			if strings.HasPrefix(p, "*") {
+				steps = append(steps, step{wildcard: true})
+				p = p[1:]
+				continue
+			}
+			i := strings.IndexAny(p, ".[")
+			if i < 0 {
+				i = len(p)
+			}
+			if i == 0 {
+				return nil, fmt.Errorf("jsonpath %s: empty name", path)
+			}
+			steps = append(steps, step{key: p[:i]})
+			p = p[i:]
+		case '[':
+			i := strings.Index(p, "]")
+			if i < 0 {
+				return nil, fmt.Errorf("jsonpath %s: unclosed [", path)
+			}
+			sel := p[1:i]
+			p = p[i+1:]
+			switch {
+			case sel == "*":
+				steps = append(steps, step{wildcard: true})
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				steps = append(steps, step{key: sel[1 : len(sel)-1]})
+			default:
+				n, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %s: invalid index %s", path, sel)
+				}
+				steps = append(steps, step{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("jsonpath %s: unexpected %q", path, p[0])
+		}
+	}
+	return steps, nil
+}
+
+func (s step) apply(n interface{}) ([]interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(n))
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if s.wildcard {
+			keys := make([]string, 0, v.Len())
+			for _, k := range v.MapKeys() {
+				keys = append(keys, k.String())
+			}
+			sort.Strings(keys)
+			res := make([]interface{}, 0, len(keys))
+			for _, k := range keys {
+				res = append(res, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())).Interface())
+			}
+			return res, nil
+		}
+		if s.isIndex {
+			break
+		}
+		e := v.MapIndex(reflect.ValueOf(s.key).Convert(v.Type().Key()))
+		if !e.IsValid() {
+			return nil, fmt.Errorf("not found")
+		}
+		return []interface{}{e.Interface()}, nil
+	case reflect.Slice, reflect.Array:
+		if s.wildcard {
+			res := make([]interface{}, 0, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				res = append(res, v.Index(i).Interface())
+			}
+			return res, nil
+		}
+		if !s.isIndex {
+			break
+		}
+		i := s.index
+		if i < 0 {
+			i += v.Len()
+		}
+		if i < 0 || i >= v.Len() {
+			return nil, fmt.Errorf("index out of range")
+		}
+		return []interface{}{v.Index(i).Interface()}, nil
+	case reflect.Struct:
+		if s.wildcard || s.isIndex {
+			break
+		}
+		f, err := el.FieldByName(v.Interface(), "json", s.key)
+		if err != nil {
+			return nil, fmt.Errorf("not found")
+		}
+		return []interface{}{f}, nil
+	}
+	return nil, fmt.Errorf("cannot apply %s to %T", s, n)
+}
@@ -1,47 +1,404 @@
 package math
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	gomath "math"
+	"math/big"
 	"reflect"
 
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 type oprnd interface{}
-type operation func(float64, float64) float64
 
 // Pkg contains custom functions defined by this package.
+//
+// Operands can be of any integer or float type (including named types),
+// *big.Int, *big.Float or json.Number. Integer operands are processed
+// without loss of precision: result of operation on integers is uint64 (if
+// all operands are unsigned and result fits), int64 (if result fits) or
+// *big.Int (if any operand is *big.Int or result overflows int64). Result of
+// operation with any float operand is float64.
+//
+// Functions return error for operands of other types, for division by zero,
+// and so on.
 var Pkg = use.FuncMap{
-	// Adds all operands, converting them to float64.
+	// func add(op ...interface{}) (interface{}, error)
+	// Adds all operands.
 	"add": add,
-	// Subtracts all operands from the first, converting them to float64.
+	// func sub(op ...interface{}) (interface{}, error)
+	// Subtracts all operands from the first.
 	"sub": sub,
-	// Multiplies all operands, converting them to float64.
+	// func mul(op ...interface{}) (interface{}, error)
+	// Multiplies all operands.
 	"mul": mul,
+	// func div(op ...interface{}) (float64, error)
 	// Divides first operand on all other operands, converting them to float64.
 	"div": div,
+	// func idiv(op ...interface{}) (interface{}, error)
+	// Divides first integer operand on all other integer operands, truncating
+	// result (as Go's "/" for integers).
+	"idiv": idiv,
+	// func mod(x, y interface{}) (interface{}, error)
+	// Returns remainder of x/y (as Go's "%" for integers or math.Mod() for
+	// floats).
+	"mod": mod,
+	// func pow(x, y interface{}) (interface{}, error)
+	// Returns x**y. Result is integer, if x and y are integers and y >= 0.
+	"pow": pow,
+	// func min(op ...interface{}) (interface{}, error)
+	// Returns the smallest operand.
+	"min": min,
+	// func max(op ...interface{}) (interface{}, error)
+	// Returns the largest operand.
+	"max": max,
+	// func abs(x interface{}) (interface{}, error)
+	// Returns absolute value of x.
+	"abs": abs,
+	// func round(x interface{}) (interface{}, error)
+	// Returns the nearest integer, rounding half away from zero. Integer
+	// operand is returned as is.
+	"round": round,
+	// func ceil(x interface{}) (interface{}, error)
+	// Returns the least integer value greater than or equal to x.
+	"ceil": ceil,
+	// func floor(x interface{}) (interface{}, error)
+	// Returns the greatest integer value less than or equal to x.
+	"floor": floor,
+	// func cmp(x, y interface{}) (int, error)
+	// Compares numbers of any (mixed) types, returns -1, 0 or +1.
+	"cmp": cmp,
+	// func numEq(x, y interface{}) (bool, error)
+	// Reports whether x == y, for numbers of any (mixed) types.
+	// Also "numNe", "numLt", "numLe", "numGt" and "numGe". Unlike builtin
+	// functions of "text/template" ("eq", "lt", etc) they allow to compare
+	// numbers of different types.
+	"numEq": compare(func(c int) bool { return c == 0 }),
+	"numNe": compare(func(c int) bool { return c != 0 }),
+	"numLt": compare(func(c int) bool { return c < 0 }),
+	"numLe": compare(func(c int) bool { return c <= 0 }),
+	"numGt": compare(func(c int) bool { return c > 0 }),
+	"numGe": compare(func(c int) bool { return c >= 0 }),
 }
 
-func toIntrnl(op oprnd) float64 {
-	return reflect.ValueOf(op).Convert(reflect.TypeOf(float64(0))).Float()
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+// maxPowBits limits size of the integer result of "pow".
+const maxPowBits = 1 << 16
+
+var errDivByZero = errors.New("division by zero")
+
+// num is an operand, converted to internal representation.
+type num struct {
+	i        *big.Int // integer value, nil for floats
+	f        float64  // float value
+	unsigned bool     // operand was of unsigned type
+	big      bool     // operand was *big.Int
 }
 
-func perform(f operation, op ...oprnd) oprnd {
-	res := toIntrnl(op[0])
-	for i, l := 1, len(op); i < l; i++ {
-		res = f(res, toIntrnl(op[i]))
+func toNum(op oprnd) (num, error) {
+	switch v := op.(type) {
+	case *big.Int:
+		if v == nil {
+			break
+		}
+		return num{i: new(big.Int).Set(v), big: true}, nil
+	case *big.Float:
+		if v == nil {
+			break
+		}
+		f, _ := v.Float64()
+		return num{f: f}, nil
+	case json.Number:
+		if i, ok := new(big.Int).SetString(string(v), 10); ok {
+			return num{i: i, big: !i.IsInt64()}, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return num{}, err
+		}
+		return num{f: f}, nil
+	}
+	rv := reflect.ValueOf(op)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return num{i: big.NewInt(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return num{i: new(big.Int).SetUint64(rv.Uint()), unsigned: true}, nil
+	case reflect.Float32, reflect.Float64:
+		return num{f: rv.Float()}, nil
 	}
-	return res
+	return num{}, fmt.Errorf("not a number: %T", op)
 }
 
-func add(op ...oprnd) oprnd {
-	return perform(func(a, b float64) float64 { return a + b }, op...)
+func toNums(name string, op []oprnd) ([]num, error) {
+	if len(op) == 0 {
+		return nil, fmt.Errorf("math: %s: no operands", name)
+	}
+	nums := make([]num, len(op))
+	for i, o := range op {
+		n, err := toNum(o)
+		if err != nil {
+			return nil, fmt.Errorf("math: %s: %v", name, err)
+		}
+		nums[i] = n
+	}
+	return nums, nil
 }
-func sub(op ...oprnd) oprnd {
-	return perform(func(a, b float64) float64 { return a - b }, op...)
+
+func (n num) isFloat() bool { return n.i == nil }
+
+func (n num) float() float64 {
+	if n.isFloat() {
+		return n.f
+	}
+	f, _ := new(big.Float).SetInt(n.i).Float64()
+	return f
 }
-func mul(op ...oprnd) oprnd {
-	return perform(func(a, b float64) float64 { return a * b }, op...)
+
+func anyFloat(nums []num) bool {
+	for _, n := range nums {
+		if n.isFloat() {
+			return true
+		}
+	}
+	return false
+}
+
+// result narrows integer result of operation on nums to the appropriate type.
+func result(i *big.Int, nums ...num) interface{} {
+	unsigned := true
+	for _, n := range nums {
+		if n.big {
+			return i
+		}
+		unsigned = unsigned && n.unsigned
+	}
+	if unsigned && i.IsUint64() {
+		return i.Uint64()
+	}
+	if i.IsInt64() {
+		return i.Int64()
+	}
+	return i
+}
+
+// value returns n, converted to the result type of operation on nums.
+func (n num) value(nums ...num) interface{} {
+	if anyFloat(nums) {
+		return n.float()
+	}
+	return result(n.i, nums...)
+}
+
+func perform(
+	name string,
+	fi func(a, b *big.Int) (*big.Int, error),
+	ff func(a, b float64) (float64, error),
+	op ...oprnd) (interface{}, error) {
+	nums, err := toNums(name, op)
+	if err != nil {
+		return nil, err
+	}
+	if anyFloat(nums) {
+		if ff == nil {
+			return nil, fmt.Errorf("math: %s: integer operands expected", name)
+		}
+		res := nums[0].float()
+		for _, n := range nums[1:] {
+			if res, err = ff(res, n.float()); err != nil {
+				return nil, fmt.Errorf("math: %s: %v", name, err)
+			}
+		}
+		return res, nil
+	}
+	res := nums[0].i
+	for _, n := range nums[1:] {
+		if res, err = fi(res, n.i); err != nil {
+			return nil, fmt.Errorf("math: %s: %v", name, err)
+		}
+	}
+	return result(res, nums...), nil
+}
+
+func add(op ...oprnd) (interface{}, error) {
+	return perform(
+		"add",
+		func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Add(a, b), nil },
+		func(a, b float64) (float64, error) { return a + b, nil },
+		op...)
+}
+
+func sub(op ...oprnd) (interface{}, error) {
+	return perform(
+		"sub",
+		func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Sub(a, b), nil },
+		func(a, b float64) (float64, error) { return a - b, nil },
+		op...)
+}
+
+func mul(op ...oprnd) (interface{}, error) {
+	return perform(
+		"mul",
+		func(a, b *big.Int) (*big.Int, error) { return new(big.Int).Mul(a, b), nil },
+		func(a, b float64) (float64, error) { return a * b, nil },
+		op...)
+}
+
+func div(op ...oprnd) (float64, error) {
+	nums, err := toNums("div", op)
+	if err != nil {
+		return 0, err
+	}
+	res := nums[0].float()
+	for _, n := range nums[1:] {
+		d := n.float()
+		if d == 0 {
+			return 0, fmt.Errorf("math: div: %v", errDivByZero)
+		}
+		res /= d
+	}
+	return res, nil
+}
+
+func idiv(op ...oprnd) (interface{}, error) {
+	return perform(
+		"idiv",
+		func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() == 0 {
+				return nil, errDivByZero
+			}
+			return new(big.Int).Quo(a, b), nil
+		},
+		nil,
+		op...)
 }
-func div(op ...oprnd) oprnd {
-	return perform(func(a, b float64) float64 { return a / b }, op...)
+
+func mod(x, y oprnd) (interface{}, error) {
+	return perform(
+		"mod",
+		func(a, b *big.Int) (*big.Int, error) {
+			if b.Sign() == 0 {
+				return nil, errDivByZero
+			}
+			return new(big.Int).Rem(a, b), nil
+		},
+		func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivByZero
+			}
+			return gomath.Mod(a, b), nil
+		},
+		x, y)
+}
+
+func pow(x, y oprnd) (interface{}, error) {
+	nums, err := toNums("pow", []oprnd{x, y})
+	if err != nil {
+		return nil, err
+	}
+	a, b := nums[0], nums[1]
+	if anyFloat(nums) || b.i.Sign() < 0 {
+		return gomath.Pow(a.float(), b.float()), nil
+	}
+	// Size of the result is about BitLen(a)*b bits, it's compared without
+	// multiplication to not overflow with huge b.
+	if new(big.Int).Abs(a.i).Cmp(big.NewInt(1)) > 0 &&
+		(!b.i.IsInt64() || b.i.Int64() > maxPowBits/int64(a.i.BitLen())) {
+		return nil, errors.New("math: pow: result is too large")
+	}
+	return result(new(big.Int).Exp(a.i, b.i, nil), nums...), nil
+}
+
+func compareNums(a, b num) int {
+	if !a.isFloat() && !b.isFloat() {
+		return a.i.Cmp(b.i)
+	}
+	return toBigFloat(a).Cmp(toBigFloat(b))
+}
+
+func toBigFloat(n num) *big.Float {
+	if n.isFloat() {
+		return big.NewFloat(n.f)
+	}
+	return new(big.Float).SetInt(n.i)
+}
+
+func checkNaN(name string, nums ...num) error {
+	for _, n := range nums {
+		if n.isFloat() && gomath.IsNaN(n.f) {
+			return fmt.Errorf("math: %s: NaN operand", name)
+		}
+	}
+	return nil
+}
+
+func extremum(name string, sign int, op ...oprnd) (interface{}, error) {
+	nums, err := toNums(name, op)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNaN(name, nums...); err != nil {
+		return nil, err
+	}
+	res := nums[0]
+	for _, n := range nums[1:] {
+		if compareNums(n, res) == sign {
+			res = n
+		}
+	}
+	return res.value(nums...), nil
+}
+
+func min(op ...oprnd) (interface{}, error) { return extremum("min", -1, op...) }
+func max(op ...oprnd) (interface{}, error) { return extremum("max", 1, op...) }
+
+func unary(name string, fi func(*big.Int) *big.Int, ff func(float64) float64, x oprnd) (interface{}, error) {
+	n, err := toNum(x)
+	if err != nil {
+		return nil, fmt.Errorf("math: %s: %v", name, err)
+	}
+	if n.isFloat() {
+		return ff(n.f), nil
+	}
+	return result(fi(n.i), n), nil
+}
+
+func same(i *big.Int) *big.Int { return i }
+
+func abs(x oprnd) (interface{}, error) {
+	return unary("abs", func(i *big.Int) *big.Int { return new(big.Int).Abs(i) }, gomath.Abs, x)
+}
+
+func round(x oprnd) (interface{}, error) { return unary("round", same, gomath.Round, x) }
+func ceil(x oprnd) (interface{}, error)  { return unary("ceil", same, gomath.Ceil, x) }
+func floor(x oprnd) (interface{}, error) { return unary("floor", same, gomath.Floor, x) }
+
+func cmp(x, y oprnd) (int, error) {
+	nums, err := toNums("cmp", []oprnd{x, y})
+	if err != nil {
+		return 0, err
+	}
+	if err := checkNaN("cmp", nums...); err != nil {
+		return 0, err
+	}
+	return compareNums(nums[0], nums[1]), nil
+}
+
+func compare(f func(int) bool) func(x, y oprnd) (bool, error) {
+	return func(x, y oprnd) (bool, error) {
+		c, err := cmp(x, y)
+		if err != nil {
+			return false, err
+		}
+		return f(c), nil
+	}
 }
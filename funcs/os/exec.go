@@ -0,0 +1,214 @@
+package os
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// Command describes OS command (process) to be run by CommandRunner.
+type Command struct {
+	Name  string
+	Args  []string
+	Env   []string // nil means environment of the current process.
+	Dir   string   // empty means working directory of the current process.
+	Stdin io.Reader
+}
+
+// CommandRunner runs commands. Run should write output of the command into
+// stdout and stderr and return it's exit code. Error should be returned only
+// if command could not be run or completed (not found, killed, etc.), non-zero
+// exit code is not an error at this level.
+//
+// Custom implementation can be used to stub commands in tests.
+type CommandRunner interface {
+	Run(ctx context.Context, cmd Command, stdout, stderr io.Writer) (exitCode int, err error)
+}
+
+// OSRunner is a CommandRunner, which runs real OS processes.
+var OSRunner CommandRunner = osRunner{}
+
+type osRunner struct{}
+
+func (osRunner) Run(
+	ctx context.Context,
+	c Command,
+	stdout, stderr io.Writer) (int, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Env = c.Env
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+		if ws, ok := e.Sys().(interface {
+			ExitStatus() int
+		}); ok {
+			return ws.ExitStatus(), nil
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return -1, err
+	}
+	return 0, nil
+}
+
+// ExecResult is a result of command execution, returned by "execResult".
+type ExecResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Exec is a builder of "exec" and "execResult" functions, which allows to
+// restrict and configure execution of commands.
+//
+// Zero value does not allow any command, at least Allow should be set.
+type Exec struct {
+	// Allow is a list of allowed command names (exactly as they are passed to
+	// "exec"). If empty, no command is allowed.
+	Allow []string
+	// Env is an environment of the command in form "key=value". If nil,
+	// environment of the current process is used. Use empty slice to run
+	// commands with empty environment.
+	Env []string
+	// Dir is a working directory of the command.
+	Dir string
+	// Timeout limits duration of the command, if positive.
+	Timeout time.Duration
+	// MaxOutput limits size of stdout and stderr (each) in bytes, if positive.
+	MaxOutput int
+	// Runner used to run commands, OSRunner if nil.
+	Runner CommandRunner
+}
+
+// DefaultExec configures deprecated "exec" function of Pkg. Its zero value
+// does not allow any command, so commands should be explicitly listed in
+// DefaultExec.Allow to use "exec" of Pkg (usually at program start).
+//
+// Deprecated: use Exec.Funcs() or Exec.Package() instead.
+var DefaultExec Exec
+
+func execute(name string, arg ...interface{}) ([]byte, error) {
+	return DefaultExec.exec(name, arg...)
+}
+
+// Funcs returns "exec" and "execResult" functions configured by e.
+//
+// "exec" executes command and returns it's stdout. Non-zero exit code is an
+// error (ExecError), stderr of the command is included into the error message.
+// "execResult" returns *ExecResult with stdout, stderr and exit code of the
+// command, non-zero exit code is not an error.
+//
+// Convention: if last arg is io.Reader, it goes to stdin of the command.
+func (e Exec) Funcs() use.FuncMap {
+	return use.FuncMap{
+		"exec":       e.exec,
+		"execResult": e.execResult,
+	}
+}
+
+// Package returns Funcs() as a "package" with their capabilities.
+func (e Exec) Package() use.Pkg {
+	return use.Pkg{Funcs: e.Funcs(), Caps: Caps}
+}
+
+// ExecError is returned by "exec" when command exits with non-zero code.
+type ExecError struct {
+	Name     string
+	ExitCode int
+	Stderr   []byte
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("exec %s: exit code %d", e.Name, e.ExitCode)
+	if s := strings.TrimSpace(string(e.Stderr)); s != "" {
+		msg += ": " + s
+	}
+	return msg
+}
+
+func (e Exec) exec(name string, arg ...interface{}) ([]byte, error) {
+	r, err := e.execResult(name, arg...)
+	if err != nil {
+		return nil, err
+	}
+	if r.ExitCode != 0 {
+		return r.Stdout, &ExecError{name, r.ExitCode, r.Stderr}
+	}
+	return r.Stdout, nil
+}
+
+func (e Exec) execResult(name string, arg ...interface{}) (*ExecResult, error) {
+	if !e.allowed(name) {
+		return nil, fmt.Errorf("exec %s: command is not allowed", name)
+	}
+	c := Command{Name: name, Env: e.Env, Dir: e.Dir}
+	l := len(arg)
+	if l > 0 {
+		if stdin, ok := arg[l-1].(io.Reader); ok {
+			c.Stdin = stdin
+			l--
+		}
+		for i := 0; i < l; i++ {
+			c.Args = append(c.Args, fmt.Sprint(arg[i]))
+		}
+	}
+	ctx := context.Background()
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	runner := e.Runner
+	if runner == nil {
+		runner = OSRunner
+	}
+	stdout := &limitedBuffer{limit: e.MaxOutput}
+	stderr := &limitedBuffer{limit: e.MaxOutput}
+	code, err := runner.Run(ctx, c, stdout, stderr)
+	if err != nil {
+		return nil, fmt.Errorf("exec %s: %v", name, err)
+	}
+	if stdout.exceeded || stderr.exceeded {
+		return nil, fmt.Errorf(
+			"exec %s: output exceeds limit of %d bytes", name, e.MaxOutput)
+	}
+	return &ExecResult{stdout.Bytes(), stderr.Bytes(), code}, nil
+}
+
+func (e Exec) allowed(name string) bool {
+	for _, a := range e.Allow {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBuffer discards data beyond the limit instead of returning an error,
+// so the command is not interrupted by a broken pipe.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		b.exceeded = true
+		b.Buffer.Write(p[:b.limit-b.Len()])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
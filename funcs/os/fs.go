@@ -0,0 +1,163 @@
+//go:build go1.16
+// +build go1.16
+
+package os
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/nikolay-turpitko/structor/el"
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// NewFS returns functions of this package, bound to the file system fsys
+// and environment lookup function lookupEnv (os.LookupEnv, if nil) instead
+// of the real OS. Command execution is not included.
+//
+// Paths are slash-separated and relative to the root of fsys. Leading "./"
+// and inner "." and ".." elements are resolved, paths escaping the root
+// (absolute or starting with "..") are rejected.
+//
+// It can be used with "testing/fstest".MapFS in tests, or to restrict
+// expressions to some directory of the real file system (see Dir()).
+func NewFS(fsys fs.FS, lookupEnv func(string) (string, bool)) use.FuncMap {
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	f := fsFuncs{fsys}
+	return use.FuncMap{
+		"env": func(key string) string {
+			v, _ := lookupEnv(key)
+			return v
+		},
+		"open":        f.open,
+		"readFile":    f.readFile,
+		"readTxtFile": f.readTxtFile,
+		"readAll":     io.ReadAll,
+		"glob":        f.glob,
+		"stat":        f.stat,
+		"exists":      f.exists,
+		"readDir":     f.readDir,
+		"readJSON":    f.readJSON,
+	}
+}
+
+// Dir returns functions of this package, restricted to the directory root
+// of the real file system. See NewFS().
+//
+// Note, that symbolic links within root are followed (see os.DirFS()).
+func Dir(root string) use.FuncMap {
+	return NewFS(os.DirFS(root), nil)
+}
+
+type fsFuncs struct {
+	fsys fs.FS
+}
+
+// clean converts name to the valid path within file system or returns error
+// if it escapes file system's root.
+func clean(op, name string) (string, error) {
+	p := path.Clean(name)
+	if !fs.ValidPath(p) {
+		return "", &fs.PathError{
+			Op:   op,
+			Path: name,
+			Err:  fmt.Errorf("path escapes root: %w", fs.ErrPermission),
+		}
+	}
+	return p, nil
+}
+
+func (f fsFuncs) open(ctx *el.Context, name string) (fs.File, error) {
+	p, err := clean("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Track(fsFile{file})
+	return file, nil
+}
+
+func (f fsFuncs) readFile(name string) ([]byte, error) {
+	p, err := clean("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(f.fsys, p)
+}
+
+func (f fsFuncs) readTxtFile(name string) (string, error) {
+	b, err := f.readFile(name)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (f fsFuncs) glob(pattern string) ([]string, error) {
+	p, err := clean("glob", pattern)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Glob(f.fsys, p)
+}
+
+func (f fsFuncs) stat(name string) (fs.FileInfo, error) {
+	p, err := clean("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(f.fsys, p)
+}
+
+func (f fsFuncs) exists(name string) (bool, error) {
+	_, err := f.stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f fsFuncs) readDir(name string) ([]string, error) {
+	p, err := clean("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(f.fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+func (f fsFuncs) readJSON(name string) (interface{}, error) {
+	b, err := f.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
+
+// fsFile ignores error on closing of already closed file, so expressions
+// still can close it explicitly.
+type fsFile struct{ fs.File }
+
+func (f fsFile) Close() error {
+	err := f.File.Close()
+	if errors.Is(err, fs.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -1,31 +1,96 @@
 package os
 
 import (
-	"fmt"
-	"io"
+	"encoding/json"
 	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
 
+	"github.com/nikolay-turpitko/structor/el"
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 // Pkg contains custom functions defined by this package.
+//
+// Functions to execute OS commands should be configured explicitly with the
+// list of allowed commands (see Exec). Deprecated "exec" is kept for
+// compatibility, but it denies all commands, unless they are allowed with
+// DefaultExec.
 var Pkg = use.FuncMap{
-	"env":      os.Getenv,
-	"open":     os.Open,
+	"env": os.Getenv,
+	// func open(name string) (*os.File, error)
+	// Opens file for reading. Opened file is closed automatically, when
+	// evaluation is finished (see "github.com/nikolay-turpitko/structor/el".Context.Track()).
+	"open":     open,
 	"readFile": ioutil.ReadFile,
 	// func readTxtFile(name string) (string, error)
 	// Reads text file into string.
 	"readTxtFile": readTxtFile,
 	"readAll":     ioutil.ReadAll,
+	// func glob(pattern string) ([]string, error)
+	// Returns names of all files matching pattern. See "path/filepath".Glob().
+	"glob": filepath.Glob,
+	// func stat(name string) (os.FileInfo, error)
+	"stat": os.Stat,
+	// func exists(name string) (bool, error)
+	// Checks if file exists.
+	"exists": exists,
+	// func readDir(name string) ([]string, error)
+	// Returns sorted names of directory entries.
+	"readDir": readDir,
+	// func readJSON(name string) (interface{}, error)
+	// Reads file and decodes JSON from it.
+	"readJSON": readJSON,
 	// func exec(name string, arg ...interface{}) ([]byte, error)
-	// Executes OS command (process) with given name (path).
+	// Executes OS command (process) with given name (path), if it is listed
+	// in DefaultExec.Allow.
 	//
-	// Convention: if last arg is io.Reader, it goes to stdin of the command.
+	// Deprecated: use functions, returned by Exec.Funcs().
 	"exec": execute,
 }
 
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps contains capabilities of functions of this package (including
+// functions returned by Exec.Funcs() and NewFS()).
+var Caps = use.Capabilities{
+	"env":         {use.Env},
+	"open":        {use.FS},
+	"readFile":    {use.FS},
+	"readTxtFile": {use.FS},
+	"glob":        {use.FS},
+	"stat":        {use.FS},
+	"exists":      {use.FS},
+	"readDir":     {use.FS},
+	"readJSON":    {use.FS},
+	"readAll":     {},
+	"exec":        {use.Exec},
+	"execResult":  {use.Exec},
+}
+
+func open(ctx *el.Context, name string) (*os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Track(file{f})
+	return f, nil
+}
+
+// file ignores error on closing of already closed file, so expressions
+// still can close it explicitly.
+type file struct{ *os.File }
+
+func (f file) Close() error {
+	err := f.File.Close()
+	if e, ok := err.(*os.PathError); ok && e.Err == os.ErrClosed {
+		return nil
+	}
+	return err
+}
+
 func readTxtFile(name string) (string, error) {
 	b, err := ioutil.ReadFile(name)
 	if err != nil {
@@ -34,23 +99,38 @@ func readTxtFile(name string) (string, error) {
 	return string(b), nil
 }
 
-func execute(name string, arg ...interface{}) ([]byte, error) {
-	var stdin io.Reader
-	hasStdin := false
-	args := []string{}
-	l := len(arg)
-	if l > 0 {
-		stdin, hasStdin = arg[len(arg)-1].(io.Reader)
-		if hasStdin {
-			l--
-		}
-		for i := 0; i < l; i++ {
-			args = append(args, fmt.Sprint(arg[i]))
-		}
-	}
-	cmd := exec.Command(name, args...)
-	if hasStdin {
-		cmd.Stdin = stdin
-	}
-	return cmd.Output()
+func exists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func readDir(name string) ([]string, error) {
+	fi, err := ioutil.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fi))
+	for _, f := range fi {
+		names = append(names, f.Name())
+	}
+	return names, nil
+}
+
+func readJSON(name string) (interface{}, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(b)
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
 }
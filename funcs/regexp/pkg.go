@@ -2,11 +2,15 @@ package regexp
 
 import (
 	"regexp"
+	"sync"
 
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 // Pkg contains custom functions defined by this package.
+//
+// Compiled patterns are cached (cache is shared by all evaluations and safe
+// for concurrent use), so the same pattern is compiled only once.
 var Pkg = use.FuncMap{
 	// func(re, s string) [][]string
 	// Returns regexp.FindAllStringSubmatch.
@@ -14,13 +18,68 @@ var Pkg = use.FuncMap{
 	// func indx(i,j int, a [][]string) string
 	// Indexes array and silently returns empty string if indexes are out of range.
 	"indx": indx,
+	// func matchOne(re, s string) ([]string, error)
+	// Returns the first match and its submatches (regexp.FindStringSubmatch),
+	// or nil.
+	"matchOne": matchOne,
+	// func namedMatch(re, s string) (map[string]string, error)
+	// Returns values of named groups (like `(?P<name>\w+)`) of the first match,
+	// or empty map. Result can be distributed into the fields of struct (see
+	// "github.com/nikolay-turpitko/structor".Evaluator).
+	"namedMatch": namedMatch,
+	// func replaceAll(re, repl, s string) (string, error)
+	// Replaces matches of re with repl, expanding $1 or ${name} within repl.
+	// See regexp.ReplaceAllString.
+	"replaceAll": replaceAll,
+	// func splitRe(re, s string) ([]string, error)
+	// Splits s into substrings, separated by re. See regexp.Split.
+	"splitRe": splitRe,
+	// func test(re, s string) (bool, error)
+	// Reports whether s contains any match of re.
+	"test": test,
 }
 
-func match(re, s string) ([][]string, error) {
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+// maxCached limits number of cached patterns. Cache is cleared when it's
+// full, so patterns, generated dynamically, can't consume all memory.
+const maxCached = 1000
+
+var cache = struct {
+	sync.RWMutex
+	m map[string]*regexp.Regexp
+}{m: map[string]*regexp.Regexp{}}
+
+func compile(re string) (*regexp.Regexp, error) {
+	cache.RLock()
+	r, ok := cache.m[re]
+	cache.RUnlock()
+	if ok {
+		return r, nil
+	}
 	r, err := regexp.Compile(re)
 	if err != nil {
 		return nil, err
 	}
+	cache.Lock()
+	if len(cache.m) >= maxCached {
+		cache.m = map[string]*regexp.Regexp{}
+	}
+	cache.m[re] = r
+	cache.Unlock()
+	return r, nil
+}
+
+func match(re, s string) ([][]string, error) {
+	r, err := compile(re)
+	if err != nil {
+		return nil, err
+	}
 	return r.FindAllStringSubmatch(s, -1), nil
 }
 
@@ -30,3 +89,53 @@ func indx(i, j int, a [][]string) string {
 	}
 	return ""
 }
+
+func matchOne(re, s string) ([]string, error) {
+	r, err := compile(re)
+	if err != nil {
+		return nil, err
+	}
+	return r.FindStringSubmatch(s), nil
+}
+
+func namedMatch(re, s string) (map[string]string, error) {
+	r, err := compile(re)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	m := r.FindStringSubmatch(s)
+	if m == nil {
+		return res, nil
+	}
+	for i, name := range r.SubexpNames() {
+		if name != "" {
+			res[name] = m[i]
+		}
+	}
+	return res, nil
+}
+
+func replaceAll(re, repl, s string) (string, error) {
+	r, err := compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllString(s, repl), nil
+}
+
+func splitRe(re, s string) ([]string, error) {
+	r, err := compile(re)
+	if err != nil {
+		return nil, err
+	}
+	return r.Split(s, -1), nil
+}
+
+func test(re, s string) (bool, error) {
+	r, err := compile(re)
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(s), nil
+}
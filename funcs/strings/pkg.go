@@ -1,15 +1,18 @@
 package strings
 
 import (
+	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 // Shifted (in contrast with "strings" package) args are more convenient with
-// pipes int "text/template".
+// pipes int "text/template": the subject string is always the last argument.
+// Functions, which index or cut strings, count runes, not bytes.
 
 // Pkg contains custom functions defined by this package.
 var Pkg = use.FuncMap{
@@ -31,8 +34,78 @@ var Pkg = use.FuncMap{
 	// func contains(substr, str) bool
 	// Like string.Contains, but with reordered arguments.
 	"contains": contains,
+	// func join(sep string, a interface{}) (string, error)
+	// Joins elements of slice or array a (converted to strings with
+	// fmt.Sprint), placing sep between them.
+	"join": join,
+	// func hasPrefix(prefix, s string) bool
+	// Like strings.HasPrefix, but with reordered arguments.
+	"hasPrefix": hasPrefix,
+	// func hasSuffix(suffix, s string) bool
+	// Like strings.HasSuffix, but with reordered arguments.
+	"hasSuffix": hasSuffix,
+	// func trimPrefix(prefix, s string) string
+	// Like strings.TrimPrefix, but with reordered arguments.
+	"trimPrefix": trimPrefix,
+	// func trimSuffix(suffix, s string) string
+	// Like strings.TrimSuffix, but with reordered arguments.
+	"trimSuffix": trimSuffix,
+	// func trim(cutset, s string) string
+	// Like strings.Trim, but with reordered arguments.
+	"trim": trim,
+	// func title(s string) string
+	// Returns s with the first letter of every word in upper case.
+	"title": strings.Title,
+	// func repeat(count int, s string) (string, error)
+	// Like strings.Repeat, but with reordered arguments. Returns error for
+	// negative count.
+	"repeat": repeat,
+	// func padLeft(width int, pad, s string) string
+	// Prepends copies of pad to s until it's width runes long.
+	"padLeft": padLeft,
+	// func padRight(width int, pad, s string) string
+	// Appends copies of pad to s until it's width runes long.
+	"padRight": padRight,
+	// func substr(start, end int, s string) string
+	// Returns runes of s from start to end (exclusive). Negative index counts
+	// from the end of s. Indexes are silently clamped to the length of s.
+	"substr": substr,
+	// func indexOf(substr, s string) int
+	// Returns index of the first rune of substr in s, or -1. It's not named
+	// "index" to not hide builtin function of "text/template", when package
+	// is used without prefix.
+	"indexOf": indexOf,
+	// func sprintf(format string, a ...interface{}) string
+	// See fmt.Sprintf.
+	"sprintf": fmt.Sprintf,
+	// func snakeCase(s string) string
+	// Converts s (like "userID" or "User ID") to "user_id".
+	"snakeCase": snakeCase,
+	// func camelCase(s string) string
+	// Converts s (like "user_id" or "User ID") to "userId".
+	"camelCase": camelCase,
+	// func truncate(n int, s string) string
+	// Returns at most n first runes of s.
+	"truncate": truncate,
+	// func quote(s string) string
+	// Returns double-quoted Go string literal. See strconv.Quote.
+	"quote": strconv.Quote,
+	// func unquote(s string) (string, error)
+	// Interprets s as a quoted Go string literal. See strconv.Unquote.
+	"unquote": strconv.Unquote,
+	// func lines(s string) []string
+	// Splits s into lines, terminated by "\n" or "\r\n". Unlike split, it does
+	// not return empty last line for s, terminated by newline.
+	"lines": lines,
 }
 
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
 func convert(v interface{}) string {
 	return reflect.ValueOf(v).Convert(reflect.TypeOf("")).String()
 }
@@ -48,3 +121,145 @@ func split(sep, s string) []string {
 func contains(substr, str string) bool {
 	return strings.Contains(str, substr)
 }
+
+func join(sep string, a interface{}) (string, error) {
+	v := reflect.ValueOf(a)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		return "", fmt.Errorf("join: not a slice: %T", a)
+	}
+	s := make([]string, v.Len())
+	for i := range s {
+		s[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(s, sep), nil
+}
+
+func hasPrefix(prefix, s string) bool    { return strings.HasPrefix(s, prefix) }
+func hasSuffix(suffix, s string) bool    { return strings.HasSuffix(s, suffix) }
+func trimPrefix(prefix, s string) string { return strings.TrimPrefix(s, prefix) }
+func trimSuffix(suffix, s string) string { return strings.TrimSuffix(s, suffix) }
+func trim(cutset, s string) string       { return strings.Trim(s, cutset) }
+
+func repeat(count int, s string) (string, error) {
+	if count < 0 {
+		return "", fmt.Errorf("repeat: negative count %d", count)
+	}
+	return strings.Repeat(s, count), nil
+}
+
+func padding(width int, pad, s string) string {
+	n := width - len([]rune(s))
+	p := []rune(pad)
+	if n <= 0 || len(p) == 0 {
+		return ""
+	}
+	res := make([]rune, n)
+	for i := range res {
+		res[i] = p[i%len(p)]
+	}
+	return string(res)
+}
+
+func padLeft(width int, pad, s string) string  { return padding(width, pad, s) + s }
+func padRight(width int, pad, s string) string { return s + padding(width, pad, s) }
+
+func substr(start, end int, s string) string {
+	r := []rune(s)
+	clamp := func(i int) int {
+		if i < 0 {
+			i += len(r)
+		}
+		switch {
+		case i < 0:
+			return 0
+		case i > len(r):
+			return len(r)
+		}
+		return i
+	}
+	start, end = clamp(start), clamp(end)
+	if start >= end {
+		return ""
+	}
+	return string(r[start:end])
+}
+
+func indexOf(substr, s string) int {
+	i := strings.Index(s, substr)
+	if i < 0 {
+		return i
+	}
+	return len([]rune(s[:i]))
+}
+
+func truncate(n int, s string) string {
+	if n < 0 {
+		n = 0
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// words splits s into words by non-alphanumeric characters and by changes of
+// case (like "userID" or "HTTPServer").
+func words(s string) []string {
+	words := []string{}
+	r := []rune(s)
+	start := -1
+	for i, c := range r {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			if start >= 0 {
+				words = append(words, string(r[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+		prev := r[i-1]
+		if unicode.IsUpper(c) &&
+			(!unicode.IsUpper(prev) ||
+				i+1 < len(r) && unicode.IsLower(r[i+1])) {
+			words = append(words, string(r[start:i]))
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(r[start:]))
+	}
+	return words
+}
+
+func snakeCase(s string) string {
+	return strings.ToLower(strings.Join(words(s), "_"))
+}
+
+func camelCase(s string) string {
+	w := words(s)
+	for i := range w {
+		w[i] = strings.ToLower(w[i])
+		if i > 0 {
+			w[i] = strings.Title(w[i])
+		}
+	}
+	return strings.Join(w, "")
+}
+
+func lines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return []string{}
+	}
+	l := strings.Split(s, "\n")
+	for i := range l {
+		l[i] = strings.TrimSuffix(l[i], "\r")
+	}
+	return l
+}
@@ -0,0 +1,196 @@
+package time
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nikolay-turpitko/structor/funcs/use"
+)
+
+// Pkg contains custom functions defined by this package, which use real
+// clock (time.Now()).
+var Pkg = New(time.Now)
+
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package (and functions, returned by New())
+// as pure.
+var Caps = use.PureCaps(Pkg)
+
+// New returns custom functions defined by this package, which use clock now
+// to get the current time (time.Now(), if nil). Fixed clock can be used to
+// make tests deterministic.
+//
+// Layouts can be passed to functions by name ("RFC3339", "Kitchen", "date",
+// etc, see Layouts) or as a Go layout ("2006-01-02 15:04").
+func New(now func() time.Time) use.FuncMap {
+	if now == nil {
+		now = time.Now
+	}
+	c := clock{now}
+	return use.FuncMap{
+		// func now() time.Time
+		// Returns the current time.
+		"now": now,
+		// func parseTime(layouts ...string, value string) (time.Time, error)
+		// Parses time value (last argument) using layouts (preceding
+		// arguments), which are probed in order. If layouts are omitted,
+		// common formats are probed (see CommonLayouts).
+		"parseTime": parseTime,
+		// func formatTime(layout string, t time.Time) string
+		// Formats time using layout.
+		"formatTime": formatTime,
+		// func duration(s string) (time.Duration, error)
+		// Parses duration, like "1h30m". See "time".ParseDuration().
+		"duration": time.ParseDuration,
+		// func addDuration(d interface{}, t time.Time) (time.Time, error)
+		// Adds duration (time.Duration or string, like "-24h") to t.
+		"addDuration": addDuration,
+		// func since(t time.Time) time.Duration
+		// Returns time elapsed since t.
+		"since": c.since,
+		// func until(t time.Time) time.Duration
+		// Returns duration until t.
+		"until": c.until,
+		// func unix(t time.Time) int64
+		// Returns t as a Unix time (number of seconds since January 1, 1970 UTC).
+		"unix": unix,
+		// func unixTime(sec int64) time.Time
+		// Returns local time, corresponding to the given Unix time.
+		"unixTime": unixTime,
+		// func inZone(name string, t time.Time) (time.Time, error)
+		// Returns t in the location with given name ("UTC", "Local",
+		// "Europe/Berlin", etc). See "time".LoadLocation().
+		"inZone": inZone,
+		// func truncateTime(d interface{}, t time.Time) (time.Time, error)
+		// Rounds t down to a multiple of duration d (time.Duration or string)
+		// since the zero time. See "time".Time.Truncate().
+		"truncateTime": truncateTime,
+		// func truncateDay(t time.Time) time.Time
+		// Returns the beginning of the t's day in the t's location.
+		"truncateDay": truncateDay,
+	}
+}
+
+// Layouts maps names of layouts, known to functions of this package, to Go
+// layouts.
+var Layouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"datetime":    "2006-01-02 15:04:05",
+	"date":        "2006-01-02",
+	"time":        "15:04:05",
+}
+
+// CommonLayouts is a list of layouts, probed by "parseTime", when layouts
+// are not specified.
+var CommonLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.UnixDate,
+	time.RubyDate,
+	time.ANSIC,
+}
+
+type clock struct {
+	now func() time.Time
+}
+
+func (c clock) since(t time.Time) time.Duration { return c.now().Sub(t) }
+func (c clock) until(t time.Time) time.Duration { return t.Sub(c.now()) }
+
+func layout(l string) string {
+	if s, ok := Layouts[l]; ok {
+		return s
+	}
+	return l
+}
+
+func parseTime(s ...string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, fmt.Errorf("parseTime: no value")
+	}
+	value := s[len(s)-1]
+	layouts := CommonLayouts
+	if len(s) > 1 {
+		layouts = make([]string, 0, len(s)-1)
+		for _, l := range s[:len(s)-1] {
+			layouts = append(layouts, layout(l))
+		}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("parseTime: unknown format of %q", value)
+}
+
+func formatTime(l string, t time.Time) string {
+	return t.Format(layout(l))
+}
+
+func toDuration(d interface{}) (time.Duration, error) {
+	switch v := d.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+	return 0, fmt.Errorf("not a duration: %T", d)
+}
+
+func addDuration(d interface{}, t time.Time) (time.Time, error) {
+	dd, err := toDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(dd), nil
+}
+
+func unix(t time.Time) int64 { return t.Unix() }
+
+func unixTime(sec int64) time.Time { return time.Unix(sec, 0) }
+
+func inZone(name string, t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+func truncateTime(d interface{}, t time.Time) (time.Time, error) {
+	dd, err := toDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Truncate(dd), nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,82 @@
+package use
+
+// Capability labels custom functions, which give access to resources outside
+// of the evaluated data (file system, processes, etc). Evaluator can use
+// capabilities to restrict functions available for untrusted expressions.
+type Capability string
+
+// Known capabilities.
+const (
+	// FS - reading of files.
+	FS Capability = "fs"
+	// Exec - execution of OS commands.
+	Exec Capability = "exec"
+	// Env - reading of environment variables.
+	Env Capability = "env"
+	// Crypto - encryption and generation of keys.
+	Crypto Capability = "crypto"
+	// Network - network access.
+	Network Capability = "network"
+)
+
+// Capabilities maps function names to capabilities, which they require.
+// Functions mapped to empty list are pure (they only transform their
+// arguments). Functions, missing from the map, are unknown and never allowed
+// (see Allowed()).
+type Capabilities map[string][]Capability
+
+// PackagesCaps collects capabilities of functions from all "packages" in
+// arguments into one Capabilities map, converting names the same way as
+// Packages() does. So, it can be used along with result of Packages().
+//
+// Only functions, labeled within Pkg.Caps, are included into result, others
+// remain unknown. Packages of this module export their Caps and ready-made Pkg
+// values (like "github.com/nikolay-turpitko/structor/funcs/os".Package), pure
+// custom functions can be labeled with PureCaps().
+func PackagesCaps(pkgs ...Pkg) Capabilities {
+	m := Capabilities{}
+	for _, p := range pkgs {
+		for nm, caps := range p.Caps {
+			if _, ok := p.Funcs[nm]; !ok {
+				continue
+			}
+			if p.MapName != nil {
+				nm = p.MapName(nm)
+			}
+			m[p.Prefix+nm] = caps
+		}
+	}
+	return m
+}
+
+// PureCaps labels all functions of funcs as pure (not requiring any
+// capabilities).
+func PureCaps(funcs FuncMap) Capabilities {
+	m := make(Capabilities, len(funcs))
+	for nm := range funcs {
+		m[nm] = []Capability{}
+	}
+	return m
+}
+
+// Allowed returns true if function with given name is known and requires only
+// capabilities from the allowed list.
+func (c Capabilities) Allowed(name string, allowed ...Capability) bool {
+	caps, ok := c[name]
+	if !ok {
+		return false
+	}
+	for _, cp := range caps {
+		ok := false
+		for _, a := range allowed {
+			if cp == a {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -17,6 +17,8 @@ type FuncMap template.FuncMap
 // MapNames is a function invoking for each key within Funcs to convert names
 // using custom rules. This can be used to adapt names to use with different
 // interpreters.
+// Caps labels functions of the "package" with capabilities, which they
+// require (see PackagesCaps()).
 type Pkg struct {
 	// Prefix added to function name (can be empty).
 	Prefix string
@@ -24,6 +26,14 @@ type Pkg struct {
 	MapName func(string) string
 	// Map of functions.
 	Funcs FuncMap
+	// Capabilities of functions, keyed by names within Funcs (can be nil).
+	Caps Capabilities
+}
+
+// WithPrefix returns copy of "package" with given Prefix.
+func (p Pkg) WithPrefix(prefix string) Pkg {
+	p.Prefix = prefix
+	return p
 }
 
 // Packages collects functions from all "packages" in arguments into one
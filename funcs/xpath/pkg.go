@@ -1,34 +1,168 @@
 package xpath
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
 
 	"gopkg.in/xmlpath.v2"
 
+	"github.com/nikolay-turpitko/structor/el"
+	"github.com/nikolay-turpitko/structor/funcs/internal/source"
 	"github.com/nikolay-turpitko/structor/funcs/use"
 )
 
 // Pkg contains custom functions defined by this package.
+//
+// Functions accept source of the HTML document (or XML document for
+// "xpathXML*" functions) as io.Reader, string, []byte or document (or node),
+// parsed by "xpathDoc" or "xpathXMLDoc" (*xmlpath.Node). Parsed documents
+// are cached within evaluation by source (content of string or []byte, or
+// io.Reader itself), so every source is parsed only once and the same
+// io.Reader can be used by several expressions.
+//
+// Most functions take *el.Context as the first argument, which is omitted in
+// expressions (interpreter binds it, see
+// "github.com/nikolay-turpitko/structor/el".BindContext()). Go code may pass
+// nil context to disable caching.
+//
+// Elements and attributes are matched by their local names. Namespace
+// prefixes in paths (like "atom:entry") are accepted and ignored.
 var Pkg = use.FuncMap{
-	// func xpathStrict(path string, r io.Reader) (string, error)
-	// Parses HTML, represented by r, compiles path and evaluates it to string.
-	// Returns error, if cannot find node.
+	// func xpathDoc(src interface{}) (*xmlpath.Node, error)
+	// Parses HTML document, represented by src. Result can be stored (in
+	// variable, for example) and passed to other functions of this package.
+	// See "gopkg.in/xmlpath.v2".ParseHTML().
+	"xpathDoc": htmlDoc.parse,
+	// func xpathStrict(path string, src interface{}) (string, error)
+	// Parses HTML, represented by src, compiles path and evaluates it to
+	// string. Returns error, if cannot find node.
 	// See "gopkg.in/xmlpath.v2".ParseHTML(), "gopkg.in/xmlpath.v2".Compile() and
 	// "gopkg.in/xmlpath.v2".String().
-	"xpathStrict": xpathStrict,
-	// func xpath(path string, r io.Reader) (string, error)
+	"xpathStrict": htmlDoc.xpathStrict,
+	// func xpath(path string, src interface{}) (string, error)
 	// In contrast to xpathStrict() silently return empty string, if cannot
 	// find node.
-	"xpath": xpathLoose,
+	"xpath": htmlDoc.xpathLoose,
+	// func xpathAll(path string, src interface{}) ([]string, error)
+	// Returns string values of all nodes, matched by path.
+	"xpathAll": htmlDoc.xpathAll,
+	// func xpathExists(path string, src interface{}) (bool, error)
+	// Reports whether path matches any node.
+	"xpathExists": htmlDoc.xpathExists,
+	// func xpathNodes(path string, src interface{}) ([]*xmlpath.Node, error)
+	// Returns all nodes, matched by path. Nodes can be passed to other
+	// functions of this package as src, to evaluate paths relative to them.
+	"xpathNodes": htmlDoc.xpathNodes,
+	// func xpathRecords(path string, fields ...string, src interface{}) ([]map[string]string, error)
+	// Returns a record for every node, matched by path. Fields are strings in
+	// form "name=path", where path is evaluated relative to the node.
+	// Result can be assigned to the slice of structs, records are
+	// distributed into the fields of structs by names.
+	"xpathRecords": htmlDoc.xpathRecords,
+	// func xpathXMLDoc(src interface{}) (*xmlpath.Node, error)
+	// Parses XML document, represented by src. See "gopkg.in/xmlpath.v2".Parse().
+	// Other "xpathXML*" functions are the same as above, but for XML.
+	"xpathXMLDoc":     xmlDoc.parse,
+	"xpathXMLStrict":  xmlDoc.xpathStrict,
+	"xpathXML":        xmlDoc.xpathLoose,
+	"xpathXMLAll":     xmlDoc.xpathAll,
+	"xpathXMLExists":  xmlDoc.xpathExists,
+	"xpathXMLNodes":   xmlDoc.xpathNodes,
+	"xpathXMLRecords": xmlDoc.xpathRecords,
 }
 
-func xpath(path string, r io.Reader) (string, bool, error) {
-	node, err := xmlpath.ParseHTML(r)
+// Package is a ready-made "package" of functions with their capabilities
+// (use Package.WithPrefix() to set prefix).
+var Package = use.Pkg{Funcs: Pkg, Caps: Caps}
+
+// Caps labels functions of this package as pure.
+var Caps = use.PureCaps(Pkg)
+
+// docType knows how to parse documents of some type (HTML or XML).
+type docType struct {
+	name      string
+	parseFunc func(io.Reader) (*xmlpath.Node, error)
+}
+
+var (
+	htmlDoc = docType{"html", xmlpath.ParseHTML}
+	xmlDoc  = docType{"xml", xmlpath.Parse}
+)
+
+type docKey struct {
+	docType string
+	key     interface{}
+}
+
+func (d docType) parse(ctx *el.Context, src interface{}) (*xmlpath.Node, error) {
+	if n, ok := src.(*xmlpath.Node); ok {
+		return n, nil
+	}
+	r, key, err := source.Open(src)
 	if err != nil {
-		return "", false, err
+		return nil, err
+	}
+	if key == nil {
+		return d.parseFunc(r)
+	}
+	n, err := ctx.Cached(docKey{d.name, key}, func() (interface{}, error) {
+		return d.parseFunc(r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n.(*xmlpath.Node), nil
+}
+
+// nsPrefix matches namespace prefix of the element or attribute name within
+// path (but not axis, like "child::").
+var nsPrefix = regexp.MustCompile(`(^|[/\[(@,|=:\s])[A-Za-z_][\w.-]*:([A-Za-z_*])`)
+
+// compile compiles path, removing namespace prefixes outside of quoted
+// literals.
+func compile(path string) (*xmlpath.Path, error) {
+	var b bytes.Buffer
+	for len(path) > 0 {
+		i := strings.IndexAny(path, `'"`)
+		if i < 0 {
+			i = len(path)
+		}
+		b.WriteString(nsPrefix.ReplaceAllString(path[:i], "$1$2"))
+		path = path[i:]
+		if len(path) == 0 {
+			break
+		}
+		j := strings.IndexByte(path[1:], path[0])
+		if j < 0 {
+			b.WriteString(path)
+			break
+		}
+		b.WriteString(path[:j+2])
+		path = path[j+2:]
+	}
+	return xmlpath.Compile(b.String())
+}
+
+func (d docType) prepare(
+	ctx *el.Context,
+	path string,
+	src interface{}) (*xmlpath.Path, *xmlpath.Node, error) {
+	node, err := d.parse(ctx, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := compile(path)
+	if err != nil {
+		return nil, nil, err
 	}
-	p, err := xmlpath.Compile(path)
+	return p, node, nil
+}
+
+func (d docType) xpath(ctx *el.Context, path string, src interface{}) (string, bool, error) {
+	p, node, err := d.prepare(ctx, path, src)
 	if err != nil {
 		return "", false, err
 	}
@@ -36,8 +170,8 @@ func xpath(path string, r io.Reader) (string, bool, error) {
 	return s, ok, nil
 }
 
-func xpathStrict(path string, r io.Reader) (string, error) {
-	s, ok, err := xpath(path, r)
+func (d docType) xpathStrict(ctx *el.Context, path string, src interface{}) (string, error) {
+	s, ok, err := d.xpath(ctx, path, src)
 	if err != nil {
 		return "", err
 	}
@@ -47,10 +181,79 @@ func xpathStrict(path string, r io.Reader) (string, error) {
 	return s, nil
 }
 
-func xpathLoose(path string, r io.Reader) (string, error) {
-	s, _, err := xpath(path, r)
+func (d docType) xpathLoose(ctx *el.Context, path string, src interface{}) (string, error) {
+	s, _, err := d.xpath(ctx, path, src)
 	if err != nil {
 		return "", err
 	}
 	return s, nil
 }
+
+func (d docType) xpathNodes(ctx *el.Context, path string, src interface{}) ([]*xmlpath.Node, error) {
+	p, node, err := d.prepare(ctx, path, src)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*xmlpath.Node{}
+	for it := p.Iter(node); it.Next(); {
+		nodes = append(nodes, it.Node())
+	}
+	return nodes, nil
+}
+
+func (d docType) xpathAll(ctx *el.Context, path string, src interface{}) ([]string, error) {
+	nodes, err := d.xpathNodes(ctx, path, src)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, n.String())
+	}
+	return res, nil
+}
+
+func (d docType) xpathExists(ctx *el.Context, path string, src interface{}) (bool, error) {
+	p, node, err := d.prepare(ctx, path, src)
+	if err != nil {
+		return false, err
+	}
+	return p.Exists(node), nil
+}
+
+func (d docType) xpathRecords(
+	ctx *el.Context,
+	path string,
+	args ...interface{}) ([]map[string]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("xpath: no source")
+	}
+	names := []string{}
+	paths := []*xmlpath.Path{}
+	for _, a := range args[:len(args)-1] {
+		f := fmt.Sprint(a)
+		i := strings.Index(f, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("xpath: invalid field %q, expected name=path", f)
+		}
+		p, err := compile(f[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, f[:i])
+		paths = append(paths, p)
+	}
+	nodes, err := d.xpathNodes(ctx, path, args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	res := make([]map[string]string, 0, len(nodes))
+	for _, n := range nodes {
+		r := make(map[string]string, len(names))
+		for i, p := range paths {
+			r[names[i]], _ = p.String(n)
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
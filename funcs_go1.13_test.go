@@ -0,0 +1,47 @@
+//go:build go1.13
+// +build go1.13
+
+package structor_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCryptSignEd25519PEM(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	b, err := x509.MarshalPKCS8PrivateKey(edKey)
+	assert.NoError(t, err)
+	edPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+	b, err = x509.MarshalPKIXPublicKey(edPub)
+	assert.NoError(t, err)
+	edPubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	type theStruct struct {
+		A []byte      `"message" | c_sign .Extra.ed | set`
+		B bool        `"message" | c_verify .Extra.edPub .Struct.A | set`
+		C bool        `"massage" | c_verify .Extra.edPub .Struct.A | set`
+		D bool        `"message" | c_verify .Extra.edReader .Struct.A | set`
+		E interface{} `c_publicKey .Extra.edPrivReader | set`
+	}
+	extra := map[string]interface{}{
+		"ed":           edPEM,
+		"edPub":        edPubPEM,
+		"edReader":     strings.NewReader(edPEM),
+		"edPrivReader": strings.NewReader(edPEM),
+	}
+	v := &theStruct{}
+	err = testEvaluator.Eval(v, extra)
+	assert.NoError(t, err)
+	assert.True(t, ed25519.Verify(edPub, []byte("message"), v.A))
+	assert.True(t, v.B)
+	assert.False(t, v.C)
+	assert.True(t, v.D)
+	assert.Equal(t, edPub, v.E)
+}
@@ -0,0 +1,91 @@
+//go:build go1.16
+// +build go1.16
+
+package structor_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nikolay-turpitko/structor"
+	"github.com/nikolay-turpitko/structor/el"
+	funcs_os "github.com/nikolay-turpitko/structor/funcs/os"
+	"github.com/nikolay-turpitko/structor/funcs/strings"
+	"github.com/nikolay-turpitko/structor/funcs/use"
+	"github.com/nikolay-turpitko/structor/scanner"
+)
+
+func TestOSFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/app.json": {Data: []byte(`{"name": "structor", "port": 8080}`)},
+		"conf/key.txt":  {Data: []byte("secret")},
+		"readme.txt":    {Data: []byte("readme")},
+	}
+	env := map[string]string{"KEY_FILE": "conf/key.txt"}
+	ev := structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs: use.Packages(
+					use.Pkg{Prefix: "o_", Funcs: funcs_os.NewFS(fsys, func(k string) (string, bool) {
+						v, ok := env[k]
+						return v, ok
+					})},
+					use.Pkg{Prefix: "s_", Funcs: strings.Pkg},
+				),
+			},
+		})
+	type theStruct struct {
+		A string                 `"KEY_FILE" | o_env | o_readTxtFile`
+		B string                 `o_open "./conf/../readme.txt" | o_readAll | s_string`
+		C []string               `o_glob "conf/*.json" | set`
+		D bool                   `o_exists "conf/key.txt" | set`
+		E bool                   `o_exists "absent.txt" | set`
+		F []string               `o_readDir "conf" | set`
+		G map[string]interface{} `o_readJSON "conf/app.json" | set`
+		H int64                  `(o_stat "readme.txt").Size | set`
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", v.A)
+	assert.Equal(t, "readme", v.B)
+	assert.Equal(t, []string{"conf/app.json"}, v.C)
+	assert.True(t, v.D)
+	assert.False(t, v.E)
+	assert.Equal(t, []string{"app.json", "key.txt"}, v.F)
+	assert.Equal(t, map[string]interface{}{"name": "structor", "port": 8080.0}, v.G)
+	assert.Equal(t, int64(6), v.H)
+
+	type escStruct struct {
+		A string `o_readTxtFile "../etc/passwd"`
+		B string `o_readTxtFile "/etc/passwd"`
+		C string `o_readTxtFile "conf/../../etc/passwd"`
+	}
+	err = ev.Eval(&escStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "read ../etc/passwd: path escapes root")
+	assert.Contains(t, err.Error(), "read /etc/passwd: path escapes root")
+	assert.Contains(t, err.Error(), "read conf/../../etc/passwd: path escapes root")
+
+	ev = structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs:       use.Packages(use.Pkg{Prefix: "o_", Funcs: funcs_os.Dir("./scanner")}),
+			},
+		})
+	type dirStruct struct {
+		A bool   `o_exists "test-1.txt" | set`
+		B string `o_readTxtFile "../LICENSE"`
+	}
+	v2 := &dirStruct{}
+	err = ev.Eval(v2, nil)
+	assert.Error(t, err)
+	assert.True(t, v2.A)
+	assert.Equal(t, "", v2.B)
+}
@@ -1,22 +1,45 @@
 package structor_test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"os"
+	gostrings "strings"
 	"testing"
+	"time"
 
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
 
 	"github.com/nikolay-turpitko/structor"
 	"github.com/nikolay-turpitko/structor/el"
 	"github.com/nikolay-turpitko/structor/funcs/bytes"
+	"github.com/nikolay-turpitko/structor/funcs/collections"
+	"github.com/nikolay-turpitko/structor/funcs/conv"
 	"github.com/nikolay-turpitko/structor/funcs/crypt"
 	"github.com/nikolay-turpitko/structor/funcs/encoding"
 	"github.com/nikolay-turpitko/structor/funcs/goquery"
+	funcs_json "github.com/nikolay-turpitko/structor/funcs/json"
 	"github.com/nikolay-turpitko/structor/funcs/math"
 	funcs_os "github.com/nikolay-turpitko/structor/funcs/os"
 	"github.com/nikolay-turpitko/structor/funcs/regexp"
 	"github.com/nikolay-turpitko/structor/funcs/strings"
+	funcs_time "github.com/nikolay-turpitko/structor/funcs/time"
 	"github.com/nikolay-turpitko/structor/funcs/use"
 	"github.com/nikolay-turpitko/structor/funcs/xpath"
 	"github.com/nikolay-turpitko/structor/scanner"
@@ -32,15 +55,22 @@ var testEvaluator = structor.NewEvaluator(
 				use.Pkg{Prefix: "c_", Funcs: crypt.Pkg},
 				use.Pkg{Prefix: "e_", Funcs: encoding.Pkg},
 				use.Pkg{Prefix: "g_", Funcs: goquery.Pkg},
+				use.Pkg{Prefix: "j_", Funcs: funcs_json.Pkg},
+				use.Pkg{Prefix: "l_", Funcs: collections.Pkg},
 				use.Pkg{Prefix: "m_", Funcs: math.Pkg},
 				use.Pkg{Prefix: "o_", Funcs: funcs_os.Pkg},
+				use.Pkg{Prefix: "p_", Funcs: funcs_os.Exec{Allow: []string{"/bin/sh"}}.Funcs()},
 				use.Pkg{Prefix: "r_", Funcs: regexp.Pkg},
 				use.Pkg{Prefix: "s_", Funcs: strings.Pkg},
+				use.Pkg{Prefix: "t_", Funcs: funcs_time.New(func() time.Time { return testNow })},
+				use.Pkg{Prefix: "v_", Funcs: conv.Pkg},
 				use.Pkg{Prefix: "x_", Funcs: xpath.Pkg},
 			),
 		},
 	})
 
+var testNow = time.Date(2018, 1, 25, 12, 11, 32, 0, time.UTC)
+
 func TestCrypt(t *testing.T) {
 	type theStruct struct {
 		A string `c_rot13 "structor"`
@@ -69,6 +99,246 @@ func TestCrypt(t *testing.T) {
 	assert.Equal(t, v.E, string(v.G))
 }
 
+func TestCryptHash(t *testing.T) {
+	type theStruct struct {
+		A string `"structor\n" | c_md5Hex`
+		B string `"structor\n" | b_bytes | c_sha1 | e_hex`
+		C string `"structor\n" | s_reader | c_sha256Hex`
+		D string `"structor\n" | c_sha512Base64`
+		E string `"structor" | c_hmacHex "sha256" "key"`
+		F bool   `c_secureEqual .Struct.E "e6a9e5d6e0d4b1a8e4b4b7e6c7a3a9d1" | set`
+		G bool   `c_secureEqual (c_hmacHex "sha256" "key" "structor") .Struct.E | set`
+		H []byte `"passphrase" | c_pbkdf2 "salt" 1000 | set`
+		I []byte `"secret" | c_hkdf "salt" "info" | set`
+		J []byte `"plain text" | b_bytes | c_aes .Struct.H | set`
+		K []byte `.Struct.J | c_unaes .Struct.H | set`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a228f448aa0e427fdf2214eb186d2edf", v.A)
+	assert.Equal(t, fmt.Sprintf("%x", sha1.Sum([]byte("structor\n"))), v.B)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte("structor\n"))), v.C)
+	sum512 := sha512.Sum512([]byte("structor\n"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sum512[:]), v.D)
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("structor"))
+	assert.Equal(t, fmt.Sprintf("%x", mac.Sum(nil)), v.E)
+	assert.False(t, v.F)
+	assert.True(t, v.G)
+	assert.Len(t, v.H, 32)
+	assert.Len(t, v.I, 32)
+	assert.NotEqual(t, v.H, v.I)
+	assert.Equal(t, []byte("plain text"), v.K)
+
+	type badStruct struct {
+		A string `"x" | c_hmacHex "md4" "key"`
+		B []byte `"x" | c_pbkdf2 "salt" 0 | set`
+		C string `42 | c_sha256Hex`
+	}
+	err = testEvaluator.Eval(&badStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `crypt: hmac: unknown algorithm "md4"`)
+	assert.Contains(t, err.Error(), "crypt: pbkdf2: invalid number of iterations 0")
+	assert.Contains(t, err.Error(), "unsupported source type: int")
+}
+
+func TestCryptSign(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	b, err := x509.MarshalECPrivateKey(ecKey)
+	assert.NoError(t, err)
+	ecPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}))
+	b, err = x509.MarshalPKIXPublicKey(ecKey.Public())
+	assert.NoError(t, err)
+	ecPubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	type theStruct struct {
+		A []byte `"message" | c_sign .Extra.ed | set`
+		B bool   `"message" | c_verify .Extra.edPub .Struct.A | set`
+		C bool   `"massage" | c_verify .Extra.edPub .Struct.A | set`
+		D []byte `"message" | c_sign (c_privateKey .Extra.ec) | set`
+		E bool   `"message" | c_verify (c_publicKey .Extra.ecPub) .Struct.D | set`
+		F bool   `"message" | c_verify .Extra.ec .Struct.D | set`
+		G bool   `"message" | c_verify .Extra.edPub .Struct.D | set`
+		H bool   `"message" | c_verify .Extra.ed .Struct.A | set`
+		// Keys can be read from io.Reader.
+		I []byte      `"message" | c_sign .Extra.ecReader | set`
+		J bool        `"message" | c_verify .Extra.ecPubReader .Struct.I | set`
+		K interface{} `c_publicKey .Extra.ecPrivReader | set`
+	}
+	extra := map[string]interface{}{
+		"ed":           edKey,
+		"edPub":        edPub,
+		"ec":           ecPEM,
+		"ecPub":        ecPubPEM,
+		"ecReader":     gostrings.NewReader(ecPEM),
+		"ecPubReader":  gostrings.NewReader(ecPubPEM),
+		"ecPrivReader": gostrings.NewReader(ecPEM),
+	}
+	v := &theStruct{}
+	err = testEvaluator.Eval(v, extra)
+	assert.NoError(t, err)
+	assert.True(t, ed25519.Verify(edPub, []byte("message"), v.A))
+	assert.True(t, v.B)
+	assert.False(t, v.C)
+	assert.NotEmpty(t, v.D)
+	assert.True(t, v.E)
+	assert.True(t, v.F)
+	assert.False(t, v.G)
+	assert.True(t, v.H)
+	assert.NotEmpty(t, v.I)
+	assert.True(t, v.J)
+	assert.Equal(t, ecKey.Public(), v.K)
+
+	type badStruct struct {
+		A []byte      `"message" | c_sign "not a key" | set`
+		B interface{} `c_publicKey .Extra.ed | c_privateKey | set`
+	}
+	err = testEvaluator.Eval(&badStruct{}, extra)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "crypt: privateKey: no PEM data found")
+	assert.Contains(t, err.Error(), "unsupported source type: ed25519.PublicKey")
+}
+
+func TestCollections(t *testing.T) {
+	type theStruct struct {
+		A []string               `s_fields "ccc aaa bbb aaa" | set`
+		B string                 `.Struct.A | l_first`
+		C string                 `.Struct.A | l_last`
+		D []string               `.Struct.A | l_subslice 1 -1 | set`
+		E []string               `.Struct.A | l_filter "^a" | set`
+		F []string               `.Struct.A | l_unique | set`
+		G []string               `.Struct.A | l_sort | set`
+		H string                 `.Struct.A | l_unique | l_sort | l_joinList ","`
+		I []interface{}          `.Struct.A | l_map "{{.Sub | s_upper}}" | set`
+		J []interface{}          `.Struct.A | l_map .Extra.rep 2 | set`
+		K []string               `.Extra.m | l_keys | set`
+		L []int                  `.Extra.m | l_values | set`
+		M map[string]interface{} `l_dict "x" 1 "y" "z" | set`
+		N []interface{}          `l_list 10 2.5 "a" 1 | l_sort | set`
+		O bool                   `.Extra.m | l_has "two" | set`
+		P bool                   `.Struct.L | l_has 3 | set`
+		Q bool                   `l_list 1 2 | l_has 3.0 | set`
+		R string                 `"" | l_default "def"`
+		S string                 `"val" | l_default "def"`
+		T interface{}            `l_list | l_first | set`
+		U []interface{}          `l_list 1 1.0 "1" | l_unique | set`
+	}
+	extra := map[string]interface{}{
+		"m":   map[string]int{"one": 1, "two": 2, "three": 3},
+		"rep": func(n int, s string) string { return gostrings.Repeat(s, n) },
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, extra)
+	assert.NoError(t, err)
+	assert.Equal(t, "ccc", v.B)
+	assert.Equal(t, "aaa", v.C)
+	assert.Equal(t, []string{"aaa", "bbb"}, v.D)
+	assert.Equal(t, []string{"aaa", "aaa"}, v.E)
+	assert.Equal(t, []string{"ccc", "aaa", "bbb"}, v.F)
+	assert.Equal(t, []string{"aaa", "aaa", "bbb", "ccc"}, v.G)
+	assert.Equal(t, "aaa,bbb,ccc", v.H)
+	assert.Equal(t, []interface{}{"CCC", "AAA", "BBB", "AAA"}, v.I)
+	assert.Equal(t, []interface{}{"cccccc", "aaaaaa", "bbbbbb", "aaaaaa"}, v.J)
+	assert.Equal(t, []string{"one", "three", "two"}, v.K)
+	assert.Equal(t, []int{1, 3, 2}, v.L)
+	assert.Equal(t, map[string]interface{}{"x": 1, "y": "z"}, v.M)
+	assert.Equal(t, []interface{}{1, 2.5, 10, "a"}, v.N)
+	assert.True(t, v.O)
+	assert.True(t, v.P)
+	assert.False(t, v.Q)
+	assert.Equal(t, "def", v.R)
+	assert.Equal(t, "val", v.S)
+	assert.Nil(t, v.T)
+	assert.Equal(t, []interface{}{1, "1"}, v.U)
+
+	type badStruct struct {
+		A string `"x" | l_first`
+		B string `l_dict "x" | l_keys`
+		C string `l_list 1 | l_map "{{m_div .Sub 0}}"`
+		D string `l_list 1 | l_map 42`
+	}
+	err = testEvaluator.Eval(&badStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "first: not a list: string")
+	assert.Contains(t, err.Error(), "dict: odd number of arguments")
+	assert.Contains(t, err.Error(), "map: [0]: ")
+	assert.Contains(t, err.Error(), "math: div: division by zero")
+	assert.Contains(t, err.Error(), "map: not a function or expression: int")
+}
+
+func TestConv(t *testing.T) {
+	type theStruct struct {
+		A int           `" 42 " | v_toInt | set`
+		B int           `"0x2a" | v_toInt | set`
+		C int           `"010" | v_toInt | set`
+		D int64         `1e3 | v_toInt64 | set`
+		E uint          `.Extra.num | v_toUint | set`
+		F float64       `"2.5" | v_toFloat | set`
+		G bool          `"true" | v_toBool | set`
+		H bool          `0 | v_toBool | set`
+		I string        `.Extra.dur | v_toString`
+		J string        `.Extra.ip | v_toString`
+		K time.Duration `"1h30m" | v_toDuration | set`
+		L time.Duration `90 | v_toDuration | set`
+		M []interface{} `s_fields "a b" | v_toSlice | set`
+		N int64         `"10MiB" | v_parseSize | set`
+		O int64         `"1.5 GB" | v_parseSize | set`
+		P int64         `"512" | v_parseSize | set`
+		Q int           `m_add 1 2 | v_toInt | set`
+		R int           `"0o17" | v_toInt | set`
+		S int64         `"-0b101" | v_toInt64 | set`
+		T uint          `"0XFF" | v_toUint | set`
+	}
+	extra := map[string]interface{}{
+		"num": json.Number("7"),
+		"dur": 2 * time.Second,
+		"ip":  net.IPv4(127, 0, 0, 1),
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, extra)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v.A)
+	assert.Equal(t, 42, v.B)
+	assert.Equal(t, 10, v.C)
+	assert.Equal(t, int64(1000), v.D)
+	assert.Equal(t, uint(7), v.E)
+	assert.Equal(t, 2.5, v.F)
+	assert.True(t, v.G)
+	assert.False(t, v.H)
+	assert.Equal(t, "2s", v.I)
+	assert.Equal(t, "127.0.0.1", v.J)
+	assert.Equal(t, 90*time.Minute, v.K)
+	assert.Equal(t, 90*time.Second, v.L)
+	assert.Equal(t, []interface{}{"a", "b"}, v.M)
+	assert.Equal(t, int64(10<<20), v.N)
+	assert.Equal(t, int64(1500000000), v.O)
+	assert.Equal(t, int64(512), v.P)
+	assert.Equal(t, 3, v.Q)
+	assert.Equal(t, 15, v.R)
+	assert.Equal(t, int64(-5), v.S)
+	assert.Equal(t, uint(255), v.T)
+
+	type badStruct struct {
+		A int           `1.5 | v_toInt | set`
+		B uint          `-1 | v_toUint | set`
+		C bool          `"yes" | v_toBool | set`
+		D time.Duration `"soon" | v_toDuration | set`
+		E int64         `"10 parsecs" | v_parseSize | set`
+		F []interface{} `42 | v_toSlice | set`
+	}
+	err = testEvaluator.Eval(&badStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "conv: toInt: cannot convert float64 (1.5)")
+	assert.Contains(t, err.Error(), "conv: toUint: cannot convert int (-1): value out of range")
+	assert.Contains(t, err.Error(), "conv: toBool: cannot convert string (yes): invalid syntax")
+	assert.Contains(t, err.Error(), "conv: toDuration: cannot convert string (soon)")
+	assert.Contains(t, err.Error(), `conv: parseSize: cannot convert string (10 parsecs): unknown unit "parsecs"`)
+	assert.Contains(t, err.Error(), "conv: toSlice: cannot convert int (42)")
+}
+
 func TestEncoding(t *testing.T) {
 	type theStruct struct {
 		A string `e_base64 (b_bytes "structor\n")`
@@ -103,6 +373,72 @@ func TestMath(t *testing.T) {
 	assert.Equal(t, 42, v.B2)
 	assert.Equal(t, 2, v.C)
 	assert.Equal(t, 2.5, v.D)
+
+	type typedStruct struct {
+		A interface{} `m_add 1 2 | set`
+		B int64       `m_mul .Extra.big 1000 | set`
+		C interface{} `m_mul .Extra.big .Extra.big | set`
+		D interface{} `m_add .Extra.u 1 | set`
+		E interface{} `m_add 1 0.5 | set`
+		F interface{} `m_idiv 7 2 | set`
+		G interface{} `m_mod -7 3 | set`
+		H interface{} `m_mod 7.5 2 | set`
+		I interface{} `m_pow 2 100 | set`
+		J interface{} `m_pow 2 -1 | set`
+		K interface{} `m_min 3 1.5 2 | set`
+		L interface{} `m_max 3 .Extra.u 2 | set`
+		M interface{} `m_abs -5 | set`
+		N interface{} `m_round 2.5 | set`
+		O interface{} `m_ceil 2.1 | set`
+		P interface{} `m_floor -2.1 | set`
+		Q int         `m_cmp 2 2.5 | set`
+		R bool        `m_numLt .Extra.u 1.5 | set`
+		S bool        `m_numEq 3 3.0 | set`
+	}
+	extra := map[string]interface{}{"big": int64(1) << 40, "u": uint8(1)}
+	tv := &typedStruct{}
+	err = testEvaluator.Eval(tv, extra)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), tv.A)
+	assert.Equal(t, int64(1)<<40*1000, tv.B)
+	c, _ := new(big.Int).SetString("1208925819614629174706176", 10)
+	assert.Equal(t, c, tv.C)
+	assert.Equal(t, int64(2), tv.D)
+	assert.Equal(t, 1.5, tv.E)
+	assert.Equal(t, int64(3), tv.F)
+	assert.Equal(t, int64(-1), tv.G)
+	assert.Equal(t, 1.5, tv.H)
+	p, _ := new(big.Int).SetString("1267650600228229401496703205376", 10)
+	assert.Equal(t, p, tv.I)
+	assert.Equal(t, 0.5, tv.J)
+	assert.Equal(t, 1.5, tv.K)
+	assert.Equal(t, int64(3), tv.L)
+	assert.Equal(t, int64(5), tv.M)
+	assert.Equal(t, 3.0, tv.N)
+	assert.Equal(t, 3.0, tv.O)
+	assert.Equal(t, -3.0, tv.P)
+	assert.Equal(t, -1, tv.Q)
+	assert.True(t, tv.R)
+	assert.True(t, tv.S)
+
+	type errStruct struct {
+		A interface{} `m_div 1 0 | set`
+		B interface{} `m_idiv 1 0 | set`
+		C interface{} `m_mod 1 0 | set`
+		D interface{} `m_add 1 "2" | set`
+		E interface{} `m_idiv 1.5 1 | set`
+		F interface{} `m_pow 10 1000000 | set`
+		G interface{} `m_pow 2 4611686018427387904 | set`
+	}
+	err = testEvaluator.Eval(&errStruct{}, nil)
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 7)
+	assert.Contains(t, err.Error(), "math: div: division by zero")
+	assert.Contains(t, err.Error(), "math: idiv: division by zero")
+	assert.Contains(t, err.Error(), "math: mod: division by zero")
+	assert.Contains(t, err.Error(), "math: add: not a number: string")
+	assert.Contains(t, err.Error(), "math: idiv: integer operands expected")
+	assert.Contains(t, err.Error(), "math: pow: result is too large")
 }
 
 func TestOS(t *testing.T) {
@@ -114,6 +450,10 @@ func TestOS(t *testing.T) {
 		C []byte   `.Struct.FileNameEnv | o_env | o_readFile | set`
 		D []string `"./LICENSE" | o_readFile | s_string | s_split "\n" | set`
 		E []string `"./LICENSE" | o_readTxtFile | s_split "\n" | set`
+		F []string `o_glob "./scanner/test-[12].txt" | set`
+		G bool     `o_exists "./LICENSE" | set`
+		H bool     `o_exists "./absent" | set`
+		I []string `o_readDir "./testhelper" | set`
 	}
 	os.Setenv("license_file_name", "./LICENSE")
 	v := &theStruct{}
@@ -131,6 +471,100 @@ func TestOS(t *testing.T) {
 	assert.Equal(t, 22, len(v.E))
 	assert.Contains(t, v.E[0], "MIT")
 	assert.Contains(t, v.E[14], "AS IS")
+	assert.Equal(t, []string{"scanner/test-1.txt", "scanner/test-2.txt"}, v.F)
+	assert.True(t, v.G)
+	assert.False(t, v.H)
+	assert.Equal(t, []string{"testhelper_go1.6.go", "testhelper_go1.7.go"}, v.I)
+}
+
+func TestOSClose(t *testing.T) {
+	type theStruct struct {
+		F *os.File `o_open "./LICENSE" | set`
+		A string   `.Struct.F | o_readAll | s_string`
+		B string   `error`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, nil)
+	assert.Error(t, err)
+	assert.Contains(t, v.A, "MIT")
+	_, err = v.F.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "file already closed")
+}
+
+type stubRunner struct {
+	cmds []funcs_os.Command
+}
+
+func (r *stubRunner) Run(
+	ctx context.Context,
+	cmd funcs_os.Command,
+	stdout, stderr io.Writer) (int, error) {
+	r.cmds = append(r.cmds, cmd)
+	switch cmd.Name {
+	case "openssl":
+		fmt.Fprintf(stdout, "%s", cmd.Args)
+		return 0, nil
+	case "fail":
+		fmt.Fprint(stderr, "something went wrong\n")
+		return 2, nil
+	case "verbose":
+		fmt.Fprint(stdout, "0123456789012345678901234567890123456789")
+		return 0, nil
+	}
+	return -1, fmt.Errorf("executable file not found")
+}
+
+func TestOSExec(t *testing.T) {
+	runner := &stubRunner{}
+	ev := structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs: use.Packages(
+					use.Pkg{Prefix: "o_", Funcs: funcs_os.Exec{
+						Allow:     []string{"openssl", "fail", "verbose", "absent"},
+						Env:       []string{"LANG=C"},
+						Dir:       "/tmp",
+						MaxOutput: 32,
+						Runner:    runner,
+					}.Funcs()},
+					use.Pkg{Prefix: "s_", Funcs: strings.Pkg},
+				),
+			},
+		})
+	type theStruct struct {
+		A string `o_exec "openssl" "rand" 3 | s_string`
+		B int    `(o_execResult "fail").ExitCode | set`
+		C string `(o_execResult "fail").Stderr | s_string`
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "[rand 3]", v.A)
+	assert.Equal(t, 2, v.B)
+	assert.Equal(t, "something went wrong\n", v.C)
+	assert.Equal(t, funcs_os.Command{
+		Name: "openssl",
+		Args: []string{"rand", "3"},
+		Env:  []string{"LANG=C"},
+		Dir:  "/tmp",
+	}, runner.cmds[0])
+
+	type errStruct struct {
+		A string `o_exec "fail"`
+		B string `o_exec "verbose"`
+		C string `o_exec "sh" "-c" "rm -rf /"`
+		D string `o_exec "absent"`
+	}
+	err = ev.Eval(&errStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exec fail: exit code 2: something went wrong")
+	assert.Contains(t, err.Error(), "exec verbose: output exceeds limit of 32 bytes")
+	assert.Contains(t, err.Error(), "exec sh: command is not allowed")
+	assert.Contains(t, err.Error(), "exec absent: executable file not found")
+	assert.Len(t, runner.cmds, 6)
 }
 
 func TestRegexp(t *testing.T) {
@@ -156,6 +590,42 @@ func TestRegexp(t *testing.T) {
 	assert.Equal(t, "", v.E)
 }
 
+func TestRegexpFuncs(t *testing.T) {
+	type theStruct struct {
+		A    []string          `"key: value" | r_matchOne "(\\w+): (\\w+)" | set`
+		B    []string          `"key" | r_matchOne "\\d+" | set`
+		C    map[string]string `"v1.2" | r_namedMatch "v(?P<major>\\d+)\\.(?P<minor>\\d+)" | set`
+		D    map[string]string `"xx" | r_namedMatch "v(?P<major>\\d+)" | set`
+		E    string            `"2018-01-25" | r_replaceAll "(\\d+)-(\\d+)-(\\d+)" "$3.$2.${1}"`
+		F    []string          `"a, b;c" | r_splitRe "[,;]\\s*" | set`
+		G    bool              `"abc123" | r_test "\\d" | set`
+		H    bool              `"abc" | r_test "\\d" | set`
+		_    struct{}          `"root@localhost" | r_namedMatch "(?P<User>\\w+)@(?P<Host>\\w+)" | set`
+		User string
+		Host string
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"key: value", "key", "value"}, v.A)
+	assert.Nil(t, v.B)
+	assert.Equal(t, map[string]string{"major": "1", "minor": "2"}, v.C)
+	assert.Equal(t, map[string]string{}, v.D)
+	assert.Equal(t, "25.01.2018", v.E)
+	assert.Equal(t, []string{"a", "b", "c"}, v.F)
+	assert.True(t, v.G)
+	assert.False(t, v.H)
+	assert.Equal(t, "root", v.User)
+	assert.Equal(t, "localhost", v.Host)
+
+	type badStruct struct {
+		A bool `"x" | r_test "(" | set`
+	}
+	err = testEvaluator.Eval(&badStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing closing )")
+}
+
 func TestStrings(t *testing.T) {
 	type theStruct struct {
 		A int      `set (s_atoi "42")`
@@ -176,6 +646,182 @@ func TestStrings(t *testing.T) {
 	assert.True(t, v.F)
 }
 
+func TestStringsFuncs(t *testing.T) {
+	type theStruct struct {
+		A []string `set (s_fields "aaa bbb ccc")`
+		B string   `.Struct.A | s_join ", "`
+		C bool     `"structor" | s_hasPrefix "struct" | set`
+		D bool     `"structor" | s_hasSuffix "struct" | set`
+		E string   `"v1.2" | s_trimPrefix "v"`
+		F string   `"--x--" | s_trim "-"`
+		G string   `"hello world" | s_title`
+		H string   `"ab" | s_repeat 3`
+		I string   `"7" | s_padLeft 3 "0"`
+		J string   `"ab" | s_padRight 5 ".-"`
+		K string   `"привет мир" | s_substr 7 10`
+		L string   `"привет мир" | s_substr -3 -1`
+		M int      `"привет мир" | s_indexOf "мир" | set`
+		N string   `42 | s_sprintf "%05d"`
+		O string   `"HTTPServer userID" | s_snakeCase`
+		P string   `"user_id-version2Name" | s_camelCase`
+		Q string   `"привет мир" | s_truncate 6`
+		R string   `"a\"b" | s_quote`
+		S string   `"\"a\\tb\"" | s_unquote`
+		T []string `"a\r\nb\n\nc\n" | s_lines | set`
+		U string   `set (s_join "-" (s_fields "1 2 3"))`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa, bbb, ccc", v.B)
+	assert.True(t, v.C)
+	assert.False(t, v.D)
+	assert.Equal(t, "1.2", v.E)
+	assert.Equal(t, "x", v.F)
+	assert.Equal(t, "Hello World", v.G)
+	assert.Equal(t, "ababab", v.H)
+	assert.Equal(t, "007", v.I)
+	assert.Equal(t, "ab.-.", v.J)
+	assert.Equal(t, "мир", v.K)
+	assert.Equal(t, "ми", v.L)
+	assert.Equal(t, 7, v.M)
+	assert.Equal(t, "00042", v.N)
+	assert.Equal(t, "http_server_user_id", v.O)
+	assert.Equal(t, "userIdVersion2Name", v.P)
+	assert.Equal(t, "привет", v.Q)
+	assert.Equal(t, `"a\"b"`, v.R)
+	assert.Equal(t, "a\tb", v.S)
+	assert.Equal(t, []string{"a", "b", "", "c"}, v.T)
+	assert.Equal(t, "1-2-3", v.U)
+
+	type badStruct struct {
+		A string `"x" | s_repeat -1`
+		B string `"x" | s_unquote`
+		C string `42 | s_join ","`
+	}
+	err = testEvaluator.Eval(&badStruct{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "repeat: negative count -1")
+	assert.Contains(t, err.Error(), "invalid syntax")
+	assert.Contains(t, err.Error(), "join: not a slice: int")
+}
+
+func TestJSON(t *testing.T) {
+	type server struct {
+		Host string
+		Port int
+	}
+	type theStruct struct {
+		A interface{}       `j_parseJSON .Extra | j_jsonpath "$.name" | set`
+		B float64           `.Extra | j_jsonpath "$.servers[0].port" | v_toFloat | set`
+		C string            `.Extra | j_jsonpath "$['servers'][-1].host"`
+		D []interface{}     `.Extra | j_jsonpath "$.servers[*].host" | set`
+		E []interface{}     `.Extra | j_jsonpath "$.tags.*" | set`
+		F []server          `.Extra | j_jsonpath "$.servers" | j_toJSON | j_decodeJSON | set`
+		G server            `.Extra | j_jsonpath "$.servers[1]" | j_toJSON | j_decodeJSON | set`
+		H string            `j_toJSON .Struct.G`
+		I string            `j_toPrettyJSON .Struct.G`
+		J int               `j_jsonpath "$.Port" .Struct.G | set`
+		K map[string]string `.Extra | j_jsonpath "$.tags" | j_toJSON | j_decodeJSON | set`
+		L int64             `.Extra | j_jsonpath "$.id" | v_toInt64 | set`
+		M *server           `.Extra | j_jsonpath "$.servers[0]" | j_toJSON | j_decodeJSON | set`
+		N *server           `.Extra | j_jsonpath "$.servers[1]" | j_toJSON | j_decodeJSON | set`
+	}
+	extra := `{
+		"id": 9007199254740993,
+		"name": "structor",
+		"servers": [
+			{"host": "a.example.com", "port": 8080},
+			{"host": "b.example.com", "port": 8081}
+		],
+		"tags": {"env": "prod", "app": "structor"}
+	}`
+	v := &theStruct{N: &server{}}
+	err := testEvaluator.Eval(v, extra)
+	assert.NoError(t, err)
+	assert.Equal(t, "structor", v.A)
+	assert.Equal(t, 8080.0, v.B)
+	assert.Equal(t, "b.example.com", v.C)
+	assert.Equal(t, []interface{}{"a.example.com", "b.example.com"}, v.D)
+	assert.Equal(t, []interface{}{"structor", "prod"}, v.E)
+	assert.Equal(t, []server{{"a.example.com", 8080}, {"b.example.com", 8081}}, v.F)
+	assert.Equal(t, server{"b.example.com", 8081}, v.G)
+	assert.Equal(t, `{"Host":"b.example.com","Port":8081}`, v.H)
+	assert.Equal(t, "{\n  \"Host\": \"b.example.com\",\n  \"Port\": 8081\n}", v.I)
+	assert.Equal(t, 8081, v.J)
+	assert.Equal(t, map[string]string{"env": "prod", "app": "structor"}, v.K)
+	assert.Equal(t, int64(9007199254740993), v.L)
+	assert.Equal(t, &server{"a.example.com", 8080}, v.M)
+	assert.Equal(t, &server{"b.example.com", 8081}, v.N)
+
+	type errStruct struct {
+		A interface{} `.Extra | j_jsonpath "$.servers[5].host" | set`
+		B interface{} `.Extra | j_jsonpath "$.absent" | set`
+		C interface{} `.Extra | j_jsonpath "name" | set`
+		D interface{} `j_parseJSON "{broken" | set`
+		E interface{} `j_parseJSON "{} {}" | set`
+		F server      `j_decodeJSON "{\"Port\": 1} trailing" | set`
+	}
+	err = testEvaluator.Eval(&errStruct{}, extra)
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 6)
+	assert.Contains(t, err.Error(), "j_parseJSON: unexpected data after top-level value")
+	assert.Contains(t, err.Error(), "j_decodeJSON: unexpected data after top-level value")
+	assert.Contains(t, err.Error(), "jsonpath $.servers[5].host: $.servers[5]: index out of range")
+	assert.Contains(t, err.Error(), "jsonpath $.absent: $.absent: not found")
+	assert.Contains(t, err.Error(), "jsonpath name: must start with $")
+}
+
+func TestTime(t *testing.T) {
+	type theStruct struct {
+		A time.Time     `t_now | set`
+		B time.Time     `t_parseTime "2018-01-20T10:00:00Z" | set`
+		C time.Time     `t_parseTime "2018-01-20" | set`
+		D time.Time     `t_parseTime "date" "02.01.2006" "20.01.2018" | set`
+		E string        `t_now | t_formatTime "date"`
+		F string        `t_now | t_formatTime "15:04"`
+		G time.Duration `t_duration "1h30m" | set`
+		H time.Time     `t_now | t_addDuration "-24h" | set`
+		I time.Duration `t_parseTime "2018-01-25" | t_since | set`
+		J time.Duration `t_parseTime "2018-01-26" | t_until | set`
+		K int64         `t_now | t_unix | set`
+		L time.Time     `t_unixTime 1516882292 | t_inZone "UTC" | set`
+		M time.Time     `t_now | t_truncateTime "1h" | set`
+		N time.Time     `t_now | t_truncateDay | set`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, testNow, v.A)
+	assert.Equal(t, time.Date(2018, 1, 20, 10, 0, 0, 0, time.UTC), v.B)
+	assert.Equal(t, time.Date(2018, 1, 20, 0, 0, 0, 0, time.UTC), v.C)
+	assert.Equal(t, time.Date(2018, 1, 20, 0, 0, 0, 0, time.UTC), v.D)
+	assert.Equal(t, "2018-01-25", v.E)
+	assert.Equal(t, "12:11", v.F)
+	assert.Equal(t, 90*time.Minute, v.G)
+	assert.Equal(t, time.Date(2018, 1, 24, 12, 11, 32, 0, time.UTC), v.H)
+	assert.Equal(t, 12*time.Hour+11*time.Minute+32*time.Second, v.I)
+	assert.Equal(t, 11*time.Hour+48*time.Minute+28*time.Second, v.J)
+	assert.Equal(t, int64(1516882292), v.K)
+	assert.Equal(t, testNow, v.L)
+	assert.Equal(t, time.Date(2018, 1, 25, 12, 0, 0, 0, time.UTC), v.M)
+	assert.Equal(t, time.Date(2018, 1, 25, 0, 0, 0, 0, time.UTC), v.N)
+
+	type errStruct struct {
+		A time.Time     `t_parseTime "yesterday" | set`
+		B time.Duration `t_duration "1 hour" | set`
+		C time.Time     `t_now | t_inZone "Nowhere/Never" | set`
+	}
+	err = testEvaluator.Eval(&errStruct{}, nil)
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 3)
+	assert.Contains(t, err.Error(), `parseTime: unknown format of "yesterday"`)
+
+	// Nil clock defaults to the real one.
+	now := funcs_time.New(nil)["now"].(func() time.Time)
+	assert.WithinDuration(t, time.Now(), now(), time.Minute)
+}
+
 func TestXPath(t *testing.T) {
 	extra := struct {
 		F1 []byte
@@ -280,6 +926,142 @@ func TestGoquery(t *testing.T) {
 	assert.Equal(t, "HEADER 3", v.Header)
 }
 
+func TestXPathDoc(t *testing.T) {
+	type theStruct struct {
+		R io.Reader `.Extra | s_reader | set`
+		A string    `.Struct.R | x_xpath "//span"`
+		B string    `.Struct.R | x_xpath "//b"`
+		_ struct{}  `.Extra | x_xpathDoc | let "doc"`
+		C string    `var "doc" | x_xpath "//a/@href"`
+		D string    `.Extra | x_xpath "//b"`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, `<div><span>aaa</span><b>bbb</b><a href="ccc">x</a></div>`)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa", v.A)
+	assert.Equal(t, "bbb", v.B)
+	assert.Equal(t, "ccc", v.C)
+	assert.Equal(t, "bbb", v.D)
+}
+
+func TestXPathXML(t *testing.T) {
+	type entry struct {
+		Title string
+		Link  string
+	}
+	type theStruct struct {
+		A string   `.Extra | x_xpathXML "/feed/entry/title"`
+		B []string `.Extra | x_xpathXMLAll "//entry/title" | set`
+		C bool     `.Extra | x_xpathXMLExists "//entry/media:thumbnail" | set`
+		D bool     `.Extra | x_xpathXMLExists "//entry/video" | set`
+		E []entry  `.Extra | x_xpathXMLRecords "//atom:entry" "Title=atom:title" "Link=link/@href" | set`
+		F string   `{{range x_xpathXMLNodes "//entry" .Extra}}{{x_xpath "title" .}};{{end}}`
+		G []string `.Extra | x_xpathXMLDoc | x_xpathAll "//media:thumbnail/@url" | set`
+		H string   `.Extra | x_xpathXMLStrict "//entry[2]/link/@href"`
+	}
+	feed := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+	<entry>
+		<title>First</title>
+		<link href="/1"/>
+		<media:thumbnail url="t1.png"/>
+	</entry>
+	<entry>
+		<title>Second</title>
+		<link href="/2"/>
+	</entry>
+</feed>`
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, feed)
+	assert.NoError(t, err)
+	assert.Equal(t, "First", v.A)
+	assert.Equal(t, []string{"First", "Second"}, v.B)
+	assert.True(t, v.C)
+	assert.False(t, v.D)
+	assert.Equal(t, []entry{{"First", "/1"}, {"Second", "/2"}}, v.E)
+	assert.Equal(t, "First;Second;", v.F)
+	assert.Equal(t, []string{"t1.png"}, v.G)
+	assert.Equal(t, "/2", v.H)
+}
+
+func TestGoqueryDoc(t *testing.T) {
+	type theStruct struct {
+		R io.Reader `.Extra | s_reader | set`
+		A string    `(.Struct.R | g_goquery "span").Text`
+		B string    `(.Struct.R | g_goquery "b").Text`
+		_ struct{}  `.Extra | g_goqueryDoc | let "doc"`
+		C string    `(var "doc" | g_goquery "a").AttrOr "href" ""`
+		D string    `(var "doc" | g_goquery "div" | g_goquery "b").Text`
+		E string    `(.Extra | g_goquery "b").Text`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, `<div><span>aaa</span><b>bbb</b><a href="ccc">x</a></div>`)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa", v.A)
+	assert.Equal(t, "bbb", v.B)
+	assert.Equal(t, "ccc", v.C)
+	assert.Equal(t, "bbb", v.D)
+	assert.Equal(t, "bbb", v.E)
+}
+
+func TestGoqueryHelpers(t *testing.T) {
+	type theStruct struct {
+		A string   `.Extra | g_text "h1"`
+		B []string `.Extra | g_texts "li" | set`
+		C string   `.Extra | g_attr "href" "a"`
+		D []string `.Extra | g_attrs "href" "a" | set`
+		E string   `.Extra | g_innerHTML "p"`
+		F int      `.Extra | g_count "li" | set`
+		G bool     `.Extra | g_hasMatch "ul" | set`
+		H bool     `.Extra | g_hasMatch "table" | set`
+		I string   `.Extra | g_firstMatch "li" | g_text ""`
+		J string   `.Extra | g_nth -1 "li" | g_text ""`
+		K string   `.Extra | g_goquery "ul" | g_text "li.x"`
+		L string   `.Extra | g_attr "title" "h1"`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, `
+		<h1>  Structor
+			helpers </h1>
+		<ul>
+			<li>one</li>
+			<li class="x"> two </li>
+			<li>three</li>
+		</ul>
+		<p>some <b>bold</b> text</p>
+		<a href="/1">1</a><a>none</a><a href="/2">2</a>`)
+	assert.NoError(t, err)
+	assert.Equal(t, "Structor helpers", v.A)
+	assert.Equal(t, []string{"one", "two", "three"}, v.B)
+	assert.Equal(t, "/1", v.C)
+	assert.Equal(t, []string{"/1", "/2"}, v.D)
+	assert.Equal(t, "some <b>bold</b> text", v.E)
+	assert.Equal(t, 3, v.F)
+	assert.True(t, v.G)
+	assert.False(t, v.H)
+	assert.Equal(t, "one", v.I)
+	assert.Equal(t, "three", v.J)
+	assert.Equal(t, "two", v.K)
+	assert.Equal(t, "", v.L)
+
+	// Functions don't shadow builtins, so the package can be used without
+	// prefix.
+	ev := structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{Funcs: goquery.Pkg},
+		})
+	type plainStruct struct {
+		A string `{{if eq (count "li" .Extra) 2}}{{nth 1 "li" .Extra | text ""}}{{end}}`
+		B string `{{innerHTML "p" .Extra | html}}`
+	}
+	pv := &plainStruct{}
+	err = ev.Eval(pv, `<ul><li>one</li><li>two</li></ul><p><b>bold</b></p>`)
+	assert.NoError(t, err)
+	assert.Equal(t, "two", pv.A)
+	assert.Equal(t, "&lt;b&gt;bold&lt;/b&gt;", pv.B)
+}
+
 func TestEmbedded(t *testing.T) {
 	extra := `
 		<div>
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	funcs_os "github.com/nikolay-turpitko/structor/funcs/os"
 )
 
 func TestExec(t *testing.T) {
@@ -12,14 +14,14 @@ func TestExec(t *testing.T) {
 		A string `"./LICENSE"`
 
 		// Dynamically evaluate shell script.
-		B int `printf "cat %s | wc -l" .Struct.A | o_exec "/bin/sh" "-c" | s_string | s_trimSpace | s_atoi | set`
+		B int `printf "cat %s | wc -l" .Struct.A | p_exec "/bin/sh" "-c" | s_string | s_trimSpace | s_atoi | set`
 
 		// Pipe from EL expression to shell script.
-		C int `o_open .Struct.A | o_exec "/bin/sh" "-c" "wc -l" | s_string | s_trimSpace | s_atoi | set`
+		C int `o_open .Struct.A | p_exec "/bin/sh" "-c" "wc -l" | s_string | s_trimSpace | s_atoi | set`
 
 		// Test with a reader. Note that reader can be used only once.
 		D io.Reader `o_open .Struct.A | set`
-		E int       `.Struct.D | o_exec "/bin/sh" "-c" "wc -l" | s_string | s_trimSpace | s_atoi | set`
+		E int       `.Struct.D | p_exec "/bin/sh" "-c" "wc -l" | s_string | s_trimSpace | s_atoi | set`
 		F int       `.Struct.D | o_readAll | s_string | len | set`
 		G io.Reader `o_open .Struct.A | set`
 		H int       `.Struct.G | o_readAll | s_string | len | set`
@@ -34,3 +36,32 @@ func TestExec(t *testing.T) {
 	assert.Equal(t, 0, v.F)
 	assert.Equal(t, 1073, v.H)
 }
+
+func TestExecErrors(t *testing.T) {
+	type theStruct struct {
+		A string `p_exec "/bin/sh" "-c" "echo oops >&2; exit 3"`
+		B int    `(p_execResult "/bin/sh" "-c" "exit 4").ExitCode | set`
+	}
+	v := &theStruct{}
+	err := testEvaluator.Eval(v, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exec /bin/sh: exit code 3: oops")
+	assert.Equal(t, 4, v.B)
+}
+
+func TestExecDenyByDefault(t *testing.T) {
+	exec := funcs_os.Exec{}.Funcs()["exec"].(func(string, ...interface{}) ([]byte, error))
+	_, err := exec("/bin/sh", "-c", "id")
+	assert.EqualError(t, err, "exec /bin/sh: command is not allowed")
+
+	// Deprecated "exec" of Pkg requires explicit opt-in.
+	exec = funcs_os.Pkg["exec"].(func(string, ...interface{}) ([]byte, error))
+	_, err = exec("/bin/sh", "-c", "id")
+	assert.EqualError(t, err, "exec /bin/sh: command is not allowed")
+	funcs_os.DefaultExec.Allow = []string{"/bin/sh"}
+	defer func() { funcs_os.DefaultExec.Allow = nil }()
+	out, err := exec("/bin/sh", "-c", "echo ok")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", string(out))
+	assert.NotContains(t, funcs_os.Pkg, "execResult")
+}
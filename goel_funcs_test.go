@@ -120,6 +120,36 @@ func TestGoELStrings(t *testing.T) {
 	assert.True(t, v.F)
 }
 
+func TestGoELStringsFuncs(t *testing.T) {
+	type theStruct struct {
+		A string `strings.Join(", ", strings.Fields("aaa bbb ccc"))`
+		B bool   `strings.HasPrefix("struct", "structor")`
+		C string `strings.TrimPrefix("v", "v1.2")`
+		D string `strings.PadLeft(3, "0", "7")`
+		E string `strings.Substr(7, 10, "привет мир")`
+		F int    `strings.IndexOf("мир", "привет мир")`
+		G string `strings.Sprintf("%s-%05d", "x", 42)`
+		H string `strings.SnakeCase("HTTPServer")`
+		I string `strings.CamelCase("user_id")`
+		J string `strings.Truncate(6, "привет мир")`
+		K string `strings.Unquote(strings.Quote("a\tb"))`
+	}
+	v := &theStruct{}
+	err := testGoEvaluator.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa, bbb, ccc", v.A)
+	assert.True(t, v.B)
+	assert.Equal(t, "1.2", v.C)
+	assert.Equal(t, "007", v.D)
+	assert.Equal(t, "мир", v.E)
+	assert.Equal(t, 7, v.F)
+	assert.Equal(t, "x-00042", v.G)
+	assert.Equal(t, "http_server", v.H)
+	assert.Equal(t, "userId", v.I)
+	assert.Equal(t, "привет", v.J)
+	assert.Equal(t, "a\tb", v.K)
+}
+
 func TestGoELEmbedded(t *testing.T) {
 	extra := `
 		<div>
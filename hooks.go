@@ -0,0 +1,59 @@
+package structor
+
+import (
+	"fmt"
+
+	multierror "github.com/hashicorp/go-multierror"
+
+	"github.com/nikolay-turpitko/structor/el"
+)
+
+// BeforeEvaler is an optional interface of the struct, which should be
+// prepared before evaluation of its fields (to normalize default values,
+// for example). Evaluator invokes BeforeEval() before processing of the
+// struct's fields and skips fields, if it returns error.
+//
+// Hooks are invoked on pointer to the struct, if struct is addressable.
+// Context passed to the hook contains information about struct's field
+// within its parent struct (or about the struct itself for the top-level
+// struct).
+type BeforeEvaler interface {
+	BeforeEval(ctx *el.Context) error
+}
+
+// AfterEvaler is an optional interface of the struct, which needs to
+// compute derived state after evaluation of its fields. Evaluator invokes
+// AfterEval() after all struct's fields are successfully evaluated.
+type AfterEvaler interface {
+	AfterEval(ctx *el.Context) error
+}
+
+// Validator is an optional interface of the struct, which validates itself.
+// Evaluator invokes Validate() after AfterEval() (if it's implemented),
+// when all struct's fields are successfully evaluated.
+type Validator interface {
+	Validate() error
+}
+
+func beforeEval(s interface{}, ctx *el.Context) error {
+	if h, ok := s.(BeforeEvaler); ok {
+		if err := h.BeforeEval(ctx); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("<<%s>> before eval:", ctx.LongName))
+		}
+	}
+	return nil
+}
+
+func afterEval(s interface{}, ctx *el.Context) error {
+	if h, ok := s.(AfterEvaler); ok {
+		if err := h.AfterEval(ctx); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("<<%s>> after eval:", ctx.LongName))
+		}
+	}
+	if h, ok := s.(Validator); ok {
+		if err := h.Validate(); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("<<%s>> validate:", ctx.LongName))
+		}
+	}
+	return nil
+}
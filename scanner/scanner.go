@@ -12,6 +12,7 @@ It gives:
   - custom quote characters,
   - custom escape character,
   - more relaxed syntax (have a look at tests to get an idea),
+  - dotted (namespaced) keys,
   - conventional syntax is also supported.
 
 Instead of Get/Lookup interface, scanner returns a map of key-value pairs.
@@ -132,7 +133,7 @@ func (s *splitter) split(data []byte, atEOF bool) (advance int, token []byte, er
 		s.tokenType = tokenTypeValue
 		s.waitValue = false
 	case isKeyRune(r): // key
-		advance, token, err = consume(data, s.noesc, isKeyRune)
+		advance, token, err = consume(data, s.noesc, isInnerKeyRune)
 		s.tokenType = tokenTypeKey
 	default: // some non-space garbage
 		advance, token, err = consume(data, s.noesc, not(unicode.IsSpace))
@@ -175,6 +176,12 @@ func isKeyRune(r rune) bool {
 	return unicode.In(r, unicode.Letter, unicode.Digit, unicode.Dash, unicode.Hyphen)
 }
 
+// isInnerKeyRune allows dots within keys (but not at the beginning), so keys
+// can be namespaced ("eval.json", "a.b.c").
+func isInnerKeyRune(r rune) bool {
+	return r == '.' || isKeyRune(r)
+}
+
 func isOneOf(rns ...rune) func(rune) bool {
 	return func(r rune) bool {
 		for _, rr := range rns {
@@ -80,6 +80,14 @@ func TestScanner(t *testing.T) {
 				"$y":       "77",
 			},
 		},
+		{
+			"./test-7.txt",
+			map[string]string{
+				"eval.json": "aaa",
+				"a.b.c":     "ccc",
+				"d.":        "ddd",
+			},
+		},
 	}
 
 	for _, fx := range fix {
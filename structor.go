@@ -18,6 +18,7 @@ package structor
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
 	multierror "github.com/hashicorp/go-multierror"
 
@@ -29,16 +30,74 @@ import (
 // Evaluator is an interface of evaluator, which gets structure and extra
 // context as input, iterates over `s`'s fields and evaluate expression tag on
 // every field.
+//
+// Result of expression is converted to the type of the field. Slice result,
+// which is not convertible to the field of type slice of structs, is
+// distributed element by element: elements, which are maps with string keys
+// (or structs), are assigned to the fields of the new structs by names, like
+// result of struct-level expression on the blank ("_") field.
+//
+// Optional EvalOptions can be used to adjust evaluation of the single call
+// (see WithFuncs, WithInterpreter).
 type Evaluator interface {
-	Eval(s, extra interface{}) error
+	Eval(s, extra interface{}, opts ...EvalOption) error
+}
+
+// EvalOption is an option of the single Eval call.
+type EvalOption func(*evalOptions)
+
+type evalOptions struct {
+	interpreters Interpreters
+	funcs        use.FuncMap
+}
+
+// WithFuncs passes additional custom functions to interpreters within the
+// single Eval call via el.Context.Funcs. It can be used to inject
+// request-scoped functions without creation of the new Evaluator.
+//
+// Interpreters decide themselves how to use these functions.
+// el.DefaultInterpreter and goel.Interpreter make them available to
+// expressions along with their own functions, functions passed with Eval call
+// take precedence.
+//
+// Functions from several WithFuncs options are merged.
+func WithFuncs(funcs use.FuncMap) EvalOption {
+	return func(o *evalOptions) {
+		if o.funcs == nil {
+			o.funcs = use.FuncMap{}
+		}
+		for k, f := range funcs {
+			o.funcs[k] = f
+		}
+	}
+}
+
+// WithInterpreter registers interpreter for the given tag name within the
+// single Eval call. It replaces interpreter, registered for the same tag name
+// during creation of Evaluator, if any.
+func WithInterpreter(name string, interpreter el.Interpreter) EvalOption {
+	return func(o *evalOptions) {
+		if o.interpreters == nil {
+			o.interpreters = Interpreters{}
+		}
+		o.interpreters[name] = interpreter
+	}
 }
 
 // Interpreters is a map of tag names to el.Interpreters.  Used to register
 // different interpreters for different tag names.
 //
-// Only first tag name on the struct field is currently recognized and
-// processed. So, only one EL expression per structure field, but different
-// fields of the same structure can be processed by different interpreters.
+// Only first tag name on the struct field (in lexical order) is currently
+// recognized and processed. So, only one EL expression per structure field,
+// but different fields of the same structure can be processed by different
+// interpreters.
+//
+// Besides exact tag names, map keys can be patterns, matched by the
+// Options.MatchTag function (MatchTagPrefix by default). For example,
+// interpreter registered with key "eval.*" processes tags "eval.json",
+// "eval.yaml" and so on, and receives matched part of the tag name ("json",
+// "yaml") in el.Context.TagSuffix. Exact tag names take precedence over
+// patterns, longer patterns take precedence over shorter ones.
 type Interpreters map[string]el.Interpreter
 
 // WholeTag constant can be used as tag name in the Interpreters to indicate
@@ -67,7 +126,7 @@ func NewEvaluatorWithOptions(
 	if len(interpreters) == 0 {
 		panic("no interpreters registered")
 	}
-	return &evaluator{scanner, interpreters, options}
+	return &evaluator{scanner: scanner, interpreters: interpreters, options: options}
 }
 
 // NewEvaluator returns Evaluator with desired settings.
@@ -111,6 +170,18 @@ type evaluator struct {
 	scanner      scanner.Scanner
 	interpreters Interpreters
 	options      Options
+
+	// visited contains reference values, already traversed within current
+	// Eval call (see visit()).
+	visited map[visit]bool
+}
+
+// visit is a key of the reference value (pointer, map or slice) within
+// evaluator.visited.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
 }
 
 // Options is an options to create Evaluator.
@@ -122,9 +193,60 @@ type Options struct {
 	// EvalEmptyTags causes Evaluator to invoke Interpreter for fields with
 	// empty tags.
 	EvalEmptyTags bool
+
+	// MatchTag is used to match tag names against patterns, registered in
+	// Interpreters. MatchTagPrefix is used, if it is nil.
+	MatchTag TagMatcher
+
+	// ForeignTags is a list of tag names, used by other packages (for
+	// example, "json", "yaml", "validate"). These tags are never matched
+	// against Interpreters patterns and fields having any of them are not
+	// passed to the WholeTag interpreter. This allows to mix structor's
+	// expressions with conventional tags in the same struct.
+	ForeignTags []string
+
+	// NameTag is a name of the conventional tag (for example, "json" or
+	// "yaml"), which value is used as a field name in el.Context.Name and
+	// el.Context.LongName (and so in error messages) instead of Go field
+	// name. See el.FieldName().
+	NameTag string
+
+	// MaxDepth limits depth of nested values (fields of nested structs,
+	// elements of slices and maps), which are evaluated. Evaluator returns
+	// error if struct is nested deeper. Zero means no limit.
+	MaxDepth int
+
+	// Caps contains capabilities of custom functions, known to interpreters
+	// (and passed with WithFuncs()). See use.PackagesCaps().
+	Caps use.Capabilities
+
+	// EvalCaps restricts custom functions within expressions, evaluated with
+	// special function "eval" (such expressions usually come from untrusted
+	// input, like Extra). If not nil, only functions, which require listed
+	// capabilities (see Caps), can be called from such expressions. Empty
+	// non-nil slice allows only pure functions. Functions, missing from Caps,
+	// are never allowed (so, nil Caps denies all custom functions), as well as
+	// special functions "setField" and "let", which change state outside of
+	// the expression.
+	EvalCaps []use.Capability
 }
 
-func (ev evaluator) Eval(s, extra interface{}) error {
+func (ev evaluator) Eval(s, extra interface{}, opts ...EvalOption) (err error) {
+	var o evalOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(o.interpreters) > 0 {
+		interpreters := make(Interpreters, len(ev.interpreters)+len(o.interpreters))
+		for k, i := range ev.interpreters {
+			interpreters[k] = i
+		}
+		for k, i := range o.interpreters {
+			interpreters[k] = i
+		}
+		// ev is a copy, so it's safe to replace interpreters for this call.
+		ev.interpreters = interpreters
+	}
 	v := reflect.ValueOf(s)
 	t := v.Type()
 	k := t.Kind()
@@ -143,6 +265,15 @@ func (ev evaluator) Eval(s, extra interface{}) error {
 	if k != reflect.Struct || !v.CanSet() {
 		return fmt.Errorf("structor: %T: not a settable struct", s)
 	}
+	// Every shared object is traversed only once, this also prevents infinite
+	// recursion on self-referential structures.
+	ev.visited = map[visit]bool{}
+	closers := &el.Closers{}
+	defer func() {
+		if cerr := closers.Close(); cerr != nil {
+			err = multierror.Append(err, multierror.Prefix(cerr, "structor: close:"))
+		}
+	}()
 	return multierror.Prefix(
 		ev.eval(
 			"",
@@ -151,26 +282,69 @@ func (ev evaluator) Eval(s, extra interface{}) error {
 			&el.Context{
 				Struct:   s,
 				Extra:    extra,
+				Funcs:    o.funcs,
+				Vars:     el.NewVars(nil),
+				Cache:    map[interface{}]interface{}{},
+				Closers:  closers,
 				EvalExpr: ev.evalExpr,
 				LongName: fmt.Sprintf("%T", s),
-			}), "structor:")
+			},
+			0), "structor:")
 }
 
 func (ev evaluator) evalExpr(
 	intrprName, expr string,
 	ctx *el.Context) (interface{}, error) {
 	intrpr, ok := ev.interpreters[intrprName]
+	if !ok {
+		intrpr, _, ok = ev.lookupInterpreter(intrprName)
+	}
 	if !ok {
 		return nil, fmt.Errorf("unknown interpreter: %s", intrprName)
 	}
+	// Nested expression gets a copy of context with incremented depth, so
+	// interpreters can limit recursion, however expression is evaluated.
+	c := *ctx
+	c.EvalDepth++
+	ctx = &c
+	if ev.options.EvalCaps != nil {
+		ctx = ev.restrict(ctx)
+	}
 	return intrpr.Execute(expr, ctx)
 }
 
+// restrict returns copy of ctx, which allows only custom functions with
+// capabilities listed in options.EvalCaps.
+func (ev evaluator) restrict(ctx *el.Context) *el.Context {
+	c := *ctx
+	c.CheckFunc = func(name string) error {
+		caps, ok := ev.options.Caps[name]
+		if !ok {
+			return fmt.Errorf(
+				"function %s is not allowed within eval (unknown capabilities)",
+				name)
+		}
+		if !ev.options.Caps.Allowed(name, ev.options.EvalCaps...) {
+			return fmt.Errorf(
+				"function %s is not allowed within eval (requires %v)",
+				name, caps)
+		}
+		return nil
+	}
+	// Funcs are accessible from expressions as data, so they are replaced too.
+	c.Funcs = make(use.FuncMap, len(ctx.Funcs))
+	for k, f := range ctx.Funcs {
+		c.Funcs[k] = c.Restrict(k, f)
+	}
+	return &c
+}
+
 func (ev evaluator) eval(
 	expr string,
 	interpreter el.Interpreter,
 	v reflect.Value,
-	ctx *el.Context) (err error) {
+	ctx *el.Context,
+	depth int) (err error) {
 	// Note: only errors returned by recursive call should not be prefixed.
 	defer func() {
 		if r := recover(); r != nil {
@@ -185,6 +359,11 @@ func (ev evaluator) eval(
 	if !v.IsValid() {
 		return nil
 	}
+	if ev.options.MaxDepth > 0 && depth > ev.options.MaxDepth {
+		return multierror.Prefix(
+			fmt.Errorf("max depth (%d) exceeded", ev.options.MaxDepth),
+			fmt.Sprintf("<<%s>>", ctx.LongName))
+	}
 	t := v.Type()
 	k := t.Kind()
 	v = tryUnseal(v)
@@ -208,7 +387,7 @@ func (ev evaluator) eval(
 	var merr *multierror.Error
 	var ctxSub interface{}
 	if (expr != "" || ev.options.EvalEmptyTags) && interpreter != nil {
-		ctx.Val = nil
+		ctx.Val, ctx.Type = nil, t
 		if elV.IsValid() {
 			ctx.Val = elV.Interface()
 		}
@@ -225,7 +404,13 @@ func (ev evaluator) eval(
 					}
 				} else {
 					vnv := reflect.ValueOf(result)
-					if vnv.Type().ConvertibleTo(t) || elK != reflect.Struct {
+					if !vnv.Type().ConvertibleTo(t) && isStructSlice(t, vnv) {
+						if err := ev.distributeSlice(vnv, v); err != nil {
+							merr = multierror.Append(
+								merr,
+								multierror.Prefix(err, fmt.Sprintf("<<%s>>", ctx.LongName)))
+						}
+					} else if vnv.Type().ConvertibleTo(t) || elK != reflect.Struct {
 						// Try to convert, it may give a panic with suitable
 						// message.
 						v.Set(vnv.Convert(t))
@@ -234,6 +419,9 @@ func (ev evaluator) eval(
 			}
 		}
 	}
+	if ev.visit(v, k, elV, elK) {
+		return merr.ErrorOrNil()
+	}
 	switch elK {
 	case reflect.Slice, reflect.Array:
 		prevLongName := ctx.LongName
@@ -242,13 +430,33 @@ func (ev evaluator) eval(
 			ctx.Name = v.Type().Name()
 			ctx.LongName = fmt.Sprintf("%s[%d]", ctx.LongName, i)
 			ctx.Tags = nil
-			err := ev.eval("", nil, v, ctx)
+			ctx.TagName, ctx.TagSuffix = "", ""
+			err := ev.eval("", nil, v, ctx, depth+1)
 			ctx.LongName = prevLongName
 			merr = multierror.Append(merr, err)
 		}
 	case reflect.Struct:
 		ctx.Sub = ctxSub
-		prevLongName := ctx.LongName
+		prevName, prevLongName := ctx.Name, ctx.LongName
+		// Struct-level part of the context, passed to hooks.
+		prevVal, prevType, prevOwner := ctx.Val, ctx.Type, ctx.Owner
+		prevTags, prevTagName, prevTagSuffix := ctx.Tags, ctx.TagName, ctx.TagSuffix
+		var owner interface{}
+		if elV.CanInterface() {
+			owner = elV.Interface()
+			if elV.CanAddr() {
+				owner = elV.Addr().Interface()
+			}
+		}
+		// Every struct has its own scope of variables.
+		prevVars := ctx.Vars
+		ctx.Vars = el.NewVars(prevVars)
+		defer func() { ctx.Vars = prevVars }()
+		if err := beforeEval(owner, ctx); err != nil {
+			merr = multierror.Append(merr, err)
+			break
+		}
+		failed := false
 		for i, l := 0, elV.NumField(); i < l; i++ {
 			tf := elT.Field(i)
 			tags, err := ev.scanner.Tags(tf.Tag)
@@ -256,28 +464,50 @@ func (ev evaluator) eval(
 				merr = multierror.Append(
 					merr,
 					multierror.Prefix(err, fmt.Sprintf("<<%s>>", ctx.LongName)))
+				failed = true
 				break
 			}
-			expr := ""
+			name := el.TagFieldName(tf.Name, tags, ev.options.NameTag)
+			expr, tagName, tagSuffix := "", "", ""
 			var interpreter el.Interpreter
-			for k, t := range tags {
-				if i, ok := ev.interpreters[k]; ok {
+			for _, k := range sortedKeys(tags) {
+				if i, suffix, ok := ev.lookupInterpreter(k); ok {
+					if interpreter == nil {
+						expr, interpreter = tags[k], i
+						tagName, tagSuffix = k, suffix
+					}
 					delete(tags, k)
-					expr, interpreter = t, i
 				}
 			}
-			if i, ok := ev.interpreters[WholeTag]; ok && interpreter == nil {
+			if i, ok := ev.interpreters[WholeTag]; ok &&
+				interpreter == nil &&
+				!ev.hasForeignTags(tags) {
 				delete(tags, WholeTag)
 				expr, interpreter = string(tf.Tag), i
 			}
-			ctx.Name = tf.Name
-			ctx.LongName = fmt.Sprintf("%s.%s", ctx.LongName, tf.Name)
+			ctx.Name = name
+			ctx.LongName = fmt.Sprintf("%s.%s", ctx.LongName, name)
+			ctx.Owner = owner
 			ctx.Tags = tags
+			ctx.TagName, ctx.TagSuffix = tagName, tagSuffix
 			v := elV.Field(i)
-			err = ev.eval(expr, interpreter, v, ctx)
+			if tf.Name == "_" {
+				err = ev.evalBlank(expr, interpreter, elV, ctx)
+			} else {
+				err = ev.eval(expr, interpreter, v, ctx, depth+1)
+			}
 			ctx.LongName = prevLongName
+			if err != nil {
+				failed = true
+			}
 			merr = multierror.Append(merr, err)
 		}
+		if !failed {
+			ctx.Name, ctx.Sub = prevName, ctxSub
+			ctx.Val, ctx.Type, ctx.Owner = prevVal, prevType, prevOwner
+			ctx.Tags, ctx.TagName, ctx.TagSuffix = prevTags, prevTagName, prevTagSuffix
+			merr = multierror.Append(merr, afterEval(owner, ctx))
+		}
 	case reflect.Map:
 		prevLongName := ctx.LongName
 		for _, key := range elV.MapKeys() {
@@ -285,10 +515,155 @@ func (ev evaluator) eval(
 			ctx.Name = v.Type().Name()
 			ctx.LongName = fmt.Sprintf("%s[%v]", ctx.LongName, key)
 			ctx.Tags = nil
-			err := ev.eval("", nil, v, ctx)
+			ctx.TagName, ctx.TagSuffix = "", ""
+			err := ev.eval("", nil, v, ctx, depth+1)
 			ctx.LongName = prevLongName
 			merr = multierror.Append(merr, err)
 		}
 	}
 	return merr.ErrorOrNil()
 }
+
+// evalBlank evaluates struct-level expression, placed on the blank ("_")
+// field, and distributes its result into the fields of the struct s (see
+// distribute()).
+func (ev evaluator) evalBlank(
+	expr string,
+	interpreter el.Interpreter,
+	s reflect.Value,
+	ctx *el.Context) (err error) {
+	defer func() {
+		if err != nil {
+			err = multierror.Prefix(err, fmt.Sprintf("<<%s>>", ctx.LongName))
+		}
+	}()
+	if interpreter == nil || expr == "" && !ev.options.EvalEmptyTags {
+		return nil
+	}
+	ctx.Val, ctx.Type = nil, nil
+	result, err := interpreter.Execute(expr, ctx)
+	if err != nil || ev.options.NonMutating {
+		return err
+	}
+	if r, ok := result.(string); ok && strings.TrimSpace(r) == "" {
+		// Expression is evaluated only for its side effects (like "let").
+		return nil
+	}
+	return ev.distribute(result, s)
+}
+
+// distribute assigns values of result into the fields of the struct s.
+// Result can be a map with string keys or a struct (or pointer to them), its
+// keys (field names) are matched with names of the fields of s (see
+// Options.NameTag). Unknown keys are ignored, nil result leaves fields
+// intact, other results cause error.
+func (ev evaluator) distribute(result interface{}, s reflect.Value) error {
+	values := map[string]interface{}{}
+	rv := reflect.Indirect(reflect.ValueOf(result))
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot distribute %T: keys are not strings", result)
+		}
+		for _, k := range rv.MapKeys() {
+			values[k.String()] = rv.MapIndex(k).Interface()
+		}
+	case reflect.Struct:
+		for i, l := 0, rv.NumField(); i < l; i++ {
+			if f := rv.Field(i); f.CanInterface() {
+				values[rv.Type().Field(i).Name] = f.Interface()
+			}
+		}
+	case reflect.Invalid:
+		return nil
+	default:
+		return fmt.Errorf("cannot distribute %T: not a map or struct", result)
+	}
+	var merr *multierror.Error
+	for i, l := 0, s.NumField(); i < l; i++ {
+		tf := s.Type().Field(i)
+		name := ev.fieldName(tf)
+		value, ok := values[name]
+		if !ok || tf.Name == "_" {
+			continue
+		}
+		f := tryUnseal(s.Field(i))
+		if !f.CanSet() {
+			merr = multierror.Append(merr, fmt.Errorf("%s: not settable", name))
+			continue
+		}
+		if err := el.Assign(f, value); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return merr.ErrorOrNil()
+}
+
+// isStructSlice reports if result r should be distributed into the slice of
+// structs (or pointers to structs) of type t, element by element.
+func isStructSlice(t reflect.Type, r reflect.Value) bool {
+	if t.Kind() != reflect.Slice ||
+		(r.Kind() != reflect.Slice && r.Kind() != reflect.Array) {
+		return false
+	}
+	et := t.Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	return et.Kind() == reflect.Struct
+}
+
+// distributeSlice fills slice v with elements, created from elements of src.
+// Elements, convertible to the type of v's elements, are converted, others
+// are distributed into the fields of new structs (see distribute()).
+func (ev evaluator) distributeSlice(src, v reflect.Value) error {
+	t := v.Type()
+	res := reflect.MakeSlice(t, src.Len(), src.Len())
+	var merr *multierror.Error
+	for i, l := 0, src.Len(); i < l; i++ {
+		e := res.Index(i)
+		item := src.Index(i).Interface()
+		if iv := reflect.ValueOf(item); iv.IsValid() &&
+			iv.Type().ConvertibleTo(t.Elem()) {
+			e.Set(iv.Convert(t.Elem()))
+			continue
+		}
+		if t.Elem().Kind() == reflect.Ptr {
+			e.Set(reflect.New(t.Elem().Elem()))
+			e = e.Elem()
+		}
+		if err := ev.distribute(item, e); err != nil {
+			merr = multierror.Append(
+				merr,
+				multierror.Prefix(err, fmt.Sprintf("[%d]", i)))
+		}
+	}
+	v.Set(res)
+	return merr.ErrorOrNil()
+}
+
+// visit marks reference value (pointer v to elV or map/slice elV) as
+// visited and reports if it was already visited within current Eval call.
+func (ev evaluator) visit(
+	v reflect.Value,
+	k reflect.Kind,
+	elV reflect.Value,
+	elK reflect.Kind) bool {
+	if ev.visited == nil || !elV.IsValid() {
+		return false
+	}
+	var key visit
+	switch {
+	case elK == reflect.Map || elK == reflect.Slice:
+		key = visit{elV.Pointer(), elV.Type(), elV.Len()}
+	case k == reflect.Ptr:
+		key = visit{v.Pointer(), elV.Type(), 0}
+	default:
+		return false
+	}
+	if ev.visited[key] {
+		return true
+	}
+	ev.visited[key] = true
+	return false
+}
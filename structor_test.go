@@ -3,16 +3,23 @@ package structor_test
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/nikolay-turpitko/structor"
 	"github.com/nikolay-turpitko/structor/el"
+	"github.com/nikolay-turpitko/structor/funcs/collections"
 	"github.com/nikolay-turpitko/structor/funcs/encoding"
 	"github.com/nikolay-turpitko/structor/funcs/math"
+	funcs_os "github.com/nikolay-turpitko/structor/funcs/os"
 	funcs_strings "github.com/nikolay-turpitko/structor/funcs/strings"
 	"github.com/nikolay-turpitko/structor/funcs/use"
 	"github.com/nikolay-turpitko/structor/scanner"
@@ -198,6 +205,374 @@ func TestWholeTagAutoEnclose(t *testing.T) {
 	assert.Equal(t, 42, v.C)
 }
 
+// TestTagPatterns tests matching of tag names with patterns and coexistence
+// with conventional tags.
+func TestTagPatterns(t *testing.T) {
+	suffix := el.InterpreterFunc(func(s string, ctx *el.Context) (interface{}, error) {
+		return ctx.TagSuffix + ":" + s, nil
+	})
+	ev := structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{
+			"eval.*":          suffix,
+			"eval.j*":         &cc{},
+			structor.WholeTag: &cc{},
+		},
+		structor.Options{ForeignTags: []string{"json", "yaml"}})
+	type theStruct struct {
+		A string `eval.yaml:"aaa"`
+		B int    `eval.json:"bbb"`
+		C string `json:"c" yaml:"c"`
+		D int    `something`
+		E string `eval.xml:"eee" json:"e"`
+	}
+	v := &theStruct{C: "ccc"}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml:aaa", v.A)
+	assert.Equal(t, 3, v.B)
+	assert.Equal(t, "ccc", v.C)
+	assert.Equal(t, 9, v.D)
+	assert.Equal(t, "xml:eee", v.E)
+
+	s, matched := structor.MatchTagPrefix("eval", "eval")
+	assert.True(t, matched)
+	assert.Equal(t, "", s)
+	s, matched = structor.MatchTagPrefix("eval.*", "eval.json")
+	assert.True(t, matched)
+	assert.Equal(t, "json", s)
+	_, matched = structor.MatchTagPrefix("eval.*", "json")
+	assert.False(t, matched)
+}
+
+// TestNameTag tests naming of fields by conventional tags and access to the
+// sibling fields by their names.
+func TestNameTag(t *testing.T) {
+	ev := structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{
+			"eval": &el.DefaultInterpreter{},
+		},
+		structor.Options{NameTag: "yaml"})
+	type inner struct {
+		URL  string `yaml:"base_url"`
+		Name string `yaml:"name" eval:"{{.LongName}}"`
+		Path string `yaml:"path,omitempty" eval:"{{field \"yaml\" \"base_url\"}}/{{field \"\" \"Name\"}}"`
+		Bad  string `yaml:"-" eval:"{{field \"yaml\" \"absent\"}}"`
+		Port string `yaml: 'port'
+			eval: "{{.Name}}"`
+		Addr string `eval:"{{field \"yaml\" \"port\"}}"`
+	}
+	type theStruct struct {
+		Inner inner `yaml:"server"`
+	}
+	v := &theStruct{Inner: inner{URL: "http://host"}}
+	err := ev.Eval(v, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.server.Bad>>")
+	assert.Contains(t, err.Error(), "field absent: not found")
+	assert.Equal(t, "*structor_test.theStruct.server.name", v.Inner.Name)
+	assert.Equal(t, "http://host/*structor_test.theStruct.server.name", v.Inner.Path)
+	assert.Equal(t, "port", v.Inner.Port)
+	assert.Equal(t, "port", v.Inner.Addr)
+}
+
+// TestNamedTemplates tests usage of shared named templates.
+func TestNamedTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "structor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(
+		filepath.Join(dir, "greet.tmpl"),
+		[]byte(`{{define "greet"}}Hello, {{.}}!{{end}}`),
+		0600)
+	require.NoError(t, err)
+	ev := structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs:       funcs_strings.Pkg,
+				Templates: []string{
+					`{{define "upperName"}}{{.Name | upper}}{{end}}`,
+					`{{define "num"}}{{set 42}}{{end}}`,
+				},
+				TemplateFiles: []string{filepath.Join(dir, "*.tmpl")},
+			},
+		})
+	type theStruct struct {
+		A string `template "upperName" .`
+		B string `template "greet" .Struct.A`
+		C int    `template "num"`
+	}
+	v := &theStruct{}
+	err = ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "A", v.A)
+	assert.Equal(t, "Hello, A!", v.B)
+	assert.Equal(t, 42, v.C)
+}
+
+// TestHTMLInterpreter tests usage of "html/template" based interpreter.
+func TestHTMLInterpreter(t *testing.T) {
+	ev := structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.HTMLInterpreter{
+				Funcs:     funcs_strings.Pkg,
+				Templates: []string{`{{define "link"}}<a href="/user?name={{.}}">{{.}}</a>{{end}}`},
+			},
+		})
+	type theStruct struct {
+		A string `<p>Hello, {{.Extra | upper}}!</p>`
+		B string `{{template "link" .Extra}}`
+		C int    `{{len .Extra | set}}`
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, "<b>Tom & Jerry</b>")
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Hello, &lt;B&gt;TOM &amp; JERRY&lt;/B&gt;!</p>", v.A)
+	assert.Equal(t, `<a href="/user?name=%3cb%3eTom%20%26%20Jerry%3c%2fb%3e">&lt;b&gt;Tom &amp; Jerry&lt;/b&gt;</a>`, v.B)
+	assert.Equal(t, 18, v.C)
+}
+
+type hooked struct {
+	events []string
+	Inner  hookedInner
+	Port   int    `eval:"{{set (add .Struct.Inner.Port 1)}}"`
+	Addr   string `eval:"{{.Struct.Inner.Host}}:{{.Struct.Port}}" x:"y"`
+}
+
+type hookedInner struct {
+	Host string
+	Port int `eval:"{{set .Val}}"`
+	Fail bool
+}
+
+func (h *hooked) BeforeEval(ctx *el.Context) error {
+	h.events = append(h.events, "before "+ctx.LongName)
+	return nil
+}
+
+func (h *hooked) AfterEval(ctx *el.Context) error {
+	// Context should describe the struct, not its last evaluated field.
+	h.events = append(h.events, fmt.Sprintf(
+		"after %s %q %v", ctx.LongName, ctx.TagName, ctx.Tags))
+	return nil
+}
+
+func (h *hooked) Validate() error {
+	h.events = append(h.events, "validate")
+	return nil
+}
+
+func (h *hookedInner) BeforeEval(ctx *el.Context) error {
+	if h.Host == "" {
+		h.Host = "localhost"
+	}
+	if h.Port == 0 {
+		h.Port = 8080
+	}
+	return nil
+}
+
+func (h *hookedInner) Validate() error {
+	if h.Fail {
+		return fmt.Errorf("invalid %s:%d", h.Host, h.Port)
+	}
+	return nil
+}
+
+// TestHooks tests invocation of lifecycle hooks.
+func TestHooks(t *testing.T) {
+	ev := structor.NewDefaultEvaluator(math.Pkg)
+	v := &hooked{}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", v.Inner.Host)
+	assert.Equal(t, 8080, v.Inner.Port)
+	assert.Equal(t, 8081, v.Port)
+	assert.Equal(t, "localhost:8081", v.Addr)
+	assert.Equal(
+		t,
+		[]string{
+			"before *structor_test.hooked",
+			`after *structor_test.hooked "" map[]`,
+			"validate",
+		},
+		v.events)
+
+	v = &hooked{Inner: hookedInner{Fail: true}}
+	err = ev.Eval(v, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "<<*structor_test.hooked.Inner>> validate: invalid localhost:8080")
+	assert.Equal(t, []string{"before *structor_test.hooked"}, v.events)
+}
+
+// TestStructLevelExpressions tests expressions, which populate several
+// fields at once.
+func TestStructLevelExpressions(t *testing.T) {
+	calls := 0
+	ev := structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{
+			"eval": &el.DefaultInterpreter{
+				Funcs: use.Packages(
+					use.Pkg{Funcs: funcs_strings.Pkg},
+					use.Pkg{Funcs: use.FuncMap{
+						"parse": func(s string) map[string]string {
+							calls++
+							f := strings.Split(s, ":")
+							return map[string]string{"user": f[0], "host": f[1], "port": f[2], "x": "?"}
+						},
+					}},
+				),
+			},
+		},
+		structor.Options{NameTag: "json"})
+	type inner struct {
+		X string
+		y string
+	}
+	type theStruct struct {
+		_    struct{} `eval:"{{parse .Extra | set}}"`
+		User string   `json:"user"`
+		Host string   `json:"host"`
+		Port string   `json:"port"`
+		N    int      `eval:"{{set (atoi .Struct.Port)}}"`
+		I    inner
+		_    struct{} `eval:"{{set .Struct.I}}"`
+		X    string
+		y    string
+		A    string
+		B    int
+		_    struct{} `eval:"{{setField \"A\" \"aaa\"}}{{setField \"B\" 42}}"`
+		C    string
+		D    int
+		_    struct{} `eval:"
+			{{setField \"C\" \"ccc\"}}
+			{{setField \"D\" 7}}
+		"`
+	}
+	v := &theStruct{I: inner{"xxx", "yyy"}}
+	err := ev.Eval(v, "root:localhost:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "root", v.User)
+	assert.Equal(t, "localhost", v.Host)
+	assert.Equal(t, "8080", v.Port)
+	assert.Equal(t, 8080, v.N)
+	assert.Equal(t, "xxx", v.X)
+	assert.Equal(t, "", v.y)
+	assert.Equal(t, "aaa", v.A)
+	assert.Equal(t, 42, v.B)
+	assert.Equal(t, "ccc", v.C)
+	assert.Equal(t, 7, v.D)
+
+	type errStruct struct {
+		_ struct{} `eval:"{{setField \"Absent\" 42}}"`
+	}
+	err = ev.Eval(&errStruct{}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field Absent: not found")
+}
+
+// TestSliceOfStructs tests distribution of slice of maps (or structs) into
+// slice of structs.
+func TestSliceOfStructs(t *testing.T) {
+	type item struct {
+		Title string `yaml:"title"`
+		Link  string `yaml:"link"`
+		N     int
+	}
+	type pair struct {
+		N int
+		X string
+	}
+	ev := structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{
+			"eval": &el.DefaultInterpreter{
+				Funcs: use.FuncMap{
+					"records": func() []map[string]interface{} {
+						return []map[string]interface{}{
+							{"title": "first", "link": "/1", "N": 1},
+							{"title": "second", "x": "ignored"},
+						}
+					},
+					"pairs":   func() []pair { return []pair{{3, "ignored"}} },
+					"bad":     func() []map[string]string { return []map[string]string{{"N": "x"}} },
+					"strings": func() []string { return []string{"a"} },
+					"intKeys": func() []map[int]string { return []map[int]string{{1: "a"}} },
+				},
+			},
+		},
+		structor.Options{NameTag: "yaml"})
+	type theStruct struct {
+		A []item  `eval:"{{records | set}}"`
+		B []*item `eval:"{{records | set}}"`
+		C []item  `eval:"{{pairs | set}}"`
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []item{{"first", "/1", 1}, {"second", "", 0}}, v.A)
+	assert.Equal(t, []*item{{"first", "/1", 1}, {"second", "", 0}}, v.B)
+	assert.Equal(t, []item{{"", "", 3}}, v.C)
+
+	type badStruct struct {
+		A []item `eval:"{{bad | set}}"`
+		B []item `eval:"{{strings | set}}"`
+		C []item `eval:"{{intKeys | set}}"`
+	}
+	err = ev.Eval(&badStruct{}, nil)
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 3)
+	assert.Contains(t, err.Error(), "<<*structor_test.badStruct.A>> [0] N: cannot convert string to int")
+	assert.Contains(t, err.Error(), "<<*structor_test.badStruct.B>> [0] cannot distribute string: not a map or struct")
+	assert.Contains(t, err.Error(), "<<*structor_test.badStruct.C>> [0] cannot distribute map[int]string: keys are not strings")
+
+	type badBlank struct {
+		_ struct{} `eval:"text"`
+		N int
+	}
+	err = ev.Eval(&badBlank{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "<<*structor_test.badBlank._>> cannot distribute string: not a map or struct")
+}
+
+// TestVars tests variables, shared between expressions.
+func TestVars(t *testing.T) {
+	calls := 0
+	ev := structor.NewDefaultEvaluator(use.FuncMap{
+		"fetch": func(s string) string {
+			calls++
+			return "<" + s + ">"
+		},
+	})
+	type inner struct {
+		_ struct{} `eval:"{{let \"b\" \"inner b\"}}"`
+		A string   `eval:"{{var \"a\"}}"`
+		B string   `eval:"{{var \"b\"}}"`
+	}
+	type theStruct struct {
+		_ struct{} `eval:"{{fetch .Extra | let \"a\"}}{{let \"b\" \"outer b\"}}"`
+		A string   `eval:"{{var \"a\"}}"`
+		I inner
+		B string `eval:"{{var \"b\"}}"`
+		C string `eval:"{{var \"c\"}}"`
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, "doc")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "var c: undefined")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "<doc>", v.A)
+	assert.Equal(t, "<doc>", v.I.A)
+	assert.Equal(t, "inner b", v.I.B)
+	assert.Equal(t, "outer b", v.B)
+}
+
 func TestNonMutatingEvaluator(t *testing.T) {
 	ev := structor.NewNonmutatingEvaluator(
 		scanner.Default,
@@ -224,6 +599,191 @@ func TestNonMutatingEvaluator(t *testing.T) {
 	assert.Nil(t, v.E)
 }
 
+// TestEvalOptions tests per-call functions and interpreters.
+func TestEvalOptions(t *testing.T) {
+	ev := structor.NewDefaultEvaluator(use.FuncMap{
+		"user": func() string { return "default" },
+	})
+	type theStruct struct {
+		A string `eval:"{{user}}"`
+		B int    `cc:"something"`
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", v.A)
+	assert.Equal(t, 0, v.B)
+
+	v = &theStruct{}
+	err = ev.Eval(
+		v,
+		nil,
+		structor.WithFuncs(use.FuncMap{
+			"user": func() string { return "request user" },
+		}),
+		structor.WithInterpreter("cc", &cc{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "request user", v.A)
+	assert.Equal(t, 9, v.B)
+
+	// Options do not affect subsequent calls.
+	v = &theStruct{}
+	err = ev.Eval(v, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", v.A)
+	assert.Equal(t, 0, v.B)
+}
+
+func TestEvalCaps(t *testing.T) {
+	pkgs := []use.Pkg{
+		funcs_os.Package.WithPrefix("o_"),
+		funcs_os.Exec{Allow: []string{"/bin/sh"}}.Package().WithPrefix("p_"),
+		funcs_strings.Package.WithPrefix("s_"),
+		// Functions without capabilities are unknown.
+		{Prefix: "u_", Funcs: funcs_os.Pkg},
+	}
+	ev := structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs:       use.Packages(pkgs...),
+			},
+		},
+		structor.Options{
+			Caps:     use.PackagesCaps(pkgs...),
+			EvalCaps: []use.Capability{use.FS},
+		})
+	type theStruct struct {
+		A string `eval "" .Extra.upper`
+		B bool   `eval "" .Extra.exists | set`
+		C bool   `o_exists "./LICENSE" | set`
+		D string `o_env "STRUCTOR_TEST_UNSET"`
+	}
+	extra := map[string]string{
+		"upper":  `s_upper "tenant"`,
+		"exists": `o_exists "./LICENSE" | set`,
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, extra)
+	assert.NoError(t, err)
+	assert.Equal(t, "TENANT", v.A)
+	assert.True(t, v.B)
+	assert.True(t, v.C)
+
+	type untrustedStruct struct {
+		A string `eval "" .Extra.exec`
+		B string `eval "" .Extra.env`
+		C string `eval "" .Extra.call`
+		D string `eval "" .Extra.nested`
+	}
+	extra = map[string]string{
+		"exec":   `p_exec "/bin/sh" "-c" "id"`,
+		"env":    `o_env "HOME"`,
+		"call":   `call .Funcs.o_env "HOME"`,
+		"nested": `eval "" "o_env \"HOME\""`,
+	}
+	err = ev.Eval(
+		&untrustedStruct{},
+		extra,
+		structor.WithFuncs(use.FuncMap{"o_env": os.Getenv}))
+	assert.Error(t, err)
+	merr := err.(*multierror.Error)
+	assert.Len(t, merr.Errors, 4)
+	assert.Contains(t, err.Error(), "function p_exec is not allowed within eval (requires [exec])")
+	assert.Contains(t, err.Error(), "function o_env is not allowed within eval (requires [env])")
+
+	// Functions without known capabilities are denied, as well as special
+	// functions, which change fields and variables.
+	type unknownStruct struct {
+		A string `eval "" .Extra.upper`
+		B string `eval "" .Extra.env`
+		C string `eval "" .Extra.setField`
+		D string `eval "" .Extra.let`
+	}
+	extra = map[string]string{
+		"upper":    `my_upper "tenant"`,
+		"env":      `u_env "HOME"`,
+		"setField": `setField "A" "hacked"`,
+		"let":      `let "x" "hacked"`,
+	}
+	err = ev.Eval(
+		&unknownStruct{},
+		extra,
+		structor.WithFuncs(use.FuncMap{"my_upper": strings.ToUpper}))
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 4)
+	assert.Contains(t, err.Error(), "function my_upper is not allowed within eval (unknown capabilities)")
+	assert.Contains(t, err.Error(), "function u_env is not allowed within eval (unknown capabilities)")
+	assert.Contains(t, err.Error(), "function setField is not allowed within eval (unknown capabilities)")
+	assert.Contains(t, err.Error(), "function let is not allowed within eval (unknown capabilities)")
+
+	// EvalCaps without Caps denies all custom functions.
+	ev = structor.NewEvaluatorWithOptions(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs:       use.Packages(pkgs...),
+			},
+		},
+		structor.Options{EvalCaps: []use.Capability{use.FS}})
+	v = &theStruct{}
+	err = ev.Eval(v, map[string]string{
+		"upper":  `s_upper "tenant"`,
+		"exists": `o_exists "./LICENSE" | set`,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "function s_upper is not allowed within eval (unknown capabilities)")
+	assert.Contains(t, err.Error(), "function o_exists is not allowed within eval (unknown capabilities)")
+	assert.True(t, v.C)
+}
+
+func TestLimits(t *testing.T) {
+	ev := structor.NewEvaluator(
+		scanner.Default,
+		structor.Interpreters{
+			structor.WholeTag: &el.DefaultInterpreter{
+				AutoEnclose: true,
+				Funcs: use.Packages(
+					use.Pkg{Funcs: funcs_strings.Pkg},
+					use.Pkg{Prefix: "l_", Funcs: collections.Pkg}),
+				Limits: el.Limits{MaxEvalDepth: 3, MaxOutput: 16, MaxCalls: 3},
+			},
+		})
+	type theStruct struct {
+		A string `eval "" .Extra.loop`
+		B string `{{range .Extra.many}}0123456789{{end}}`
+		C string `upper (upper (upper (upper "a")))`
+		D string `{{range .Extra.many}}{{upper "a"}}{{end}}`
+		E string `eval "" "upper (upper \"ok\")"`
+		F string `call .EvalExpr "" .Extra.callLoop .`
+		G string `l_map .Extra.mapLoop (l_list 1)`
+	}
+	extra := map[string]interface{}{
+		"loop":     `eval "" .Extra.loop`,
+		"many":     make([]int, 10),
+		"callLoop": `call .EvalExpr "" .Extra.callLoop .`,
+		"mapLoop":  `l_map .Extra.mapLoop (l_list 1)`,
+	}
+	v := &theStruct{}
+	err := ev.Eval(v, extra)
+	assert.Error(t, err)
+	merr := err.(*multierror.Error)
+	assert.Len(t, merr.Errors, 6)
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.A>> eval depth limit (3) exceeded")
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.B>> output limit (16) exceeded")
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.C>> calls limit (3) exceeded")
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.D>> calls limit (3) exceeded")
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.F>> eval depth limit (3) exceeded")
+	assert.Contains(t, err.Error(), "<<*structor_test.theStruct.G>> eval depth limit (3) exceeded")
+	assert.Equal(t, "OK", v.E)
+
+	i := &el.DefaultInterpreter{Limits: el.Limits{MaxOutput: 3}}
+	_, err = i.Execute("abcd", &el.Context{LongName: "x.Y"})
+	assert.Equal(t, &el.LimitError{Field: "x.Y", Limit: "output", Max: 3}, err)
+}
+
 // Example is an example of structor's usage.
 //
 // Whole struct tag string is used for EL expression.
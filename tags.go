@@ -0,0 +1,94 @@
+package structor
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/nikolay-turpitko/structor/el"
+)
+
+// TagMatcher is a type of function, which checks if tag name matches pattern,
+// registered in Interpreters. It returns part of the tag name, matched by
+// pattern's wildcard, to be passed to interpreter in el.Context.TagSuffix.
+type TagMatcher func(pattern, tagName string) (suffix string, ok bool)
+
+// MatchTagPrefix is a default TagMatcher. Pattern ending with "*" matches
+// any tag name with the same prefix, the rest of the name is a suffix. Other
+// patterns match only equal tag names.
+func MatchTagPrefix(pattern, tagName string) (string, bool) {
+	if !strings.HasSuffix(pattern, "*") {
+		return "", pattern == tagName
+	}
+	prefix := strings.TrimSuffix(pattern, "*")
+	if !strings.HasPrefix(tagName, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(tagName, prefix), true
+}
+
+// lookupInterpreter finds interpreter for the given tag name.
+func (ev evaluator) lookupInterpreter(tagName string) (el.Interpreter, string, bool) {
+	if tagName == WholeTag || ev.isForeignTag(tagName) {
+		return nil, "", false
+	}
+	if i, ok := ev.interpreters[tagName]; ok {
+		return i, "", true
+	}
+	match := ev.options.MatchTag
+	if match == nil {
+		match = MatchTagPrefix
+	}
+	var found el.Interpreter
+	suffix, best := "", ""
+	for p, i := range ev.interpreters {
+		if p == WholeTag || found != nil && (len(p) < len(best) ||
+			len(p) == len(best) && p > best) {
+			continue
+		}
+		if s, ok := match(p, tagName); ok {
+			found, suffix, best = i, s, p
+		}
+	}
+	return found, suffix, found != nil
+}
+
+func (ev evaluator) isForeignTag(tagName string) bool {
+	for _, t := range ev.options.ForeignTags {
+		if t == tagName {
+			return true
+		}
+	}
+	return false
+}
+
+func (ev evaluator) hasForeignTags(tags map[string]string) bool {
+	for _, t := range ev.options.ForeignTags {
+		if _, ok := tags[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldName returns name of the field, defined by options.NameTag within
+// tags, parsed by the evaluator's scanner (see el.TagFieldName()).
+func (ev evaluator) fieldName(f reflect.StructField) string {
+	if ev.options.NameTag == "" {
+		return f.Name
+	}
+	tags, err := ev.scanner.Tags(f.Tag)
+	if err != nil {
+		return f.Name
+	}
+	return el.TagFieldName(f.Name, tags, ev.options.NameTag)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}